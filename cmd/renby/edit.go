@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hidez8891/go-renby"
+)
+
+// defaultEditor is used when neither VISUAL nor EDITOR is set
+const defaultEditor = "vi"
+
+// editHeader explains the edit list written by writeEditList
+const editHeader = `# Edit the destinations below, then save and quit to rename.
+# Each line is INDEX, the current name and the destination, separated by
+# tabs; only the destination is read back. A destination without directory
+# stays next to its source. Delete a line to keep the name of its file,
+# delete every line to cancel.
+`
+
+// editPlan lets the user change the destinations of the plan in an editor
+// and returns the edited mappings
+func editPlan(plan *renby.Plan) ([]renby.Mapping, error) {
+	file, err := os.CreateTemp("", "renby-edit-*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("could not create edit file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	if err := writeEditList(file, plan); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not write edit file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("could not write edit file: %v", err)
+	}
+
+	if err := runEditor(file.Name()); err != nil {
+		return nil, err
+	}
+
+	edited, err := os.Open(file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("could not read edit file: %v", err)
+	}
+	defer edited.Close()
+	return parseEditList(edited, plan)
+}
+
+// runEditor opens path in $VISUAL, $EDITOR or vi and waits for it to exit
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = defaultEditor
+	}
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		return fmt.Errorf("invalid editor '%s'", editor)
+	}
+
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor '%s' failed: %v", editor, err)
+	}
+	return nil
+}
+
+// writeEditList writes one "INDEX\tSOURCE\tDESTINATION" line per entry of
+// the plan. Destinations in the directory of their source are written as
+// base names.
+func writeEditList(w io.Writer, plan *renby.Plan) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(editHeader)
+	for _, e := range plan.Entries {
+		dst := e.Destination
+		if filepath.Dir(dst) == filepath.Dir(e.Source) {
+			dst = filepath.Base(dst)
+		}
+		fmt.Fprintf(bw, "%d\t%s\t%s\n", e.Index, e.Source, dst)
+	}
+	return bw.Flush()
+}
+
+// parseEditList reads the lines written by writeEditList back into mappings
+// for the entries of the plan, in the order of the lines. The destination
+// follows the last tab, the source column is only shown to the user and may
+// be left out. Empty lines and lines starting with '#' are ignored.
+func parseEditList(r io.Reader, plan *renby.Plan) ([]renby.Mapping, error) {
+	sources := make(map[int]string, len(plan.Entries))
+	for _, e := range plan.Entries {
+		sources[e.Index] = e.Source
+	}
+
+	var mappings []renby.Mapping
+	seen := make(map[int]struct{})
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		num, rest, ok := strings.Cut(line, "\t")
+		index, err := strconv.Atoi(strings.TrimSpace(num))
+		if !ok || err != nil {
+			return nil, fmt.Errorf("edit line %d: expected INDEX<TAB>SOURCE<TAB>DESTINATION", lineNo)
+		}
+		dst := rest[strings.LastIndex(rest, "\t")+1:]
+		src, known := sources[index]
+		if !known {
+			return nil, fmt.Errorf("edit line %d: unknown index %d", lineNo, index)
+		}
+		if _, dup := seen[index]; dup {
+			return nil, fmt.Errorf("edit line %d: index %d is listed more than once", lineNo, index)
+		}
+		seen[index] = struct{}{}
+		if dst == "" {
+			return nil, fmt.Errorf("edit line %d: destination must not be empty", lineNo)
+		}
+		mappings = append(mappings, renby.Mapping{Source: src, Destination: dst})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read edit file: %v", err)
+	}
+	return mappings, nil
+}
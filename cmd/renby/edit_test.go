@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hidez8891/go-renby"
+)
+
+func TestWriteEditList(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "a.txt")
+	outside := filepath.Join(tmpDir, "out", "b.txt")
+	plan := &renby.Plan{Entries: []renby.PlanEntry{
+		{Index: 0, Source: src, Destination: filepath.Join(tmpDir, "000001.txt")},
+		{Index: 1, Source: filepath.Join(tmpDir, "b.txt"), Destination: outside},
+	}}
+
+	var buf bytes.Buffer
+	if err := writeEditList(&buf, plan); err != nil {
+		t.Fatal(err)
+	}
+	want := editHeader + "0\t" + src + "\t000001.txt\n" + "1\t" + filepath.Join(tmpDir, "b.txt") + "\t" + outside + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeEditList() = %q, want %q", got, want)
+	}
+}
+
+func TestParseEditList(t *testing.T) {
+	plan := &renby.Plan{Entries: []renby.PlanEntry{
+		{Index: 0, Source: "/d/a.txt", Destination: "/d/000001.txt"},
+		{Index: 1, Source: "/d/b.txt", Destination: "/d/000002.txt"},
+	}}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    []renby.Mapping
+		wantErr bool
+	}{
+		{
+			name:  "unchanged",
+			input: editHeader + "0\t000001.txt\n1\t000002.txt\n",
+			want:  []renby.Mapping{{Source: "/d/a.txt", Destination: "000001.txt"}, {Source: "/d/b.txt", Destination: "000002.txt"}},
+		},
+		{
+			name:  "source column",
+			input: editHeader + "0\t/d/a.txt\tfirst.txt\n1\t/d/b.txt\t000002.txt\n",
+			want:  []renby.Mapping{{Source: "/d/a.txt", Destination: "first.txt"}, {Source: "/d/b.txt", Destination: "000002.txt"}},
+		},
+		{
+			name:  "reordered and edited",
+			input: "1\tsecond.txt\r\n\n0\t/e/first.txt\n",
+			want:  []renby.Mapping{{Source: "/d/b.txt", Destination: "second.txt"}, {Source: "/d/a.txt", Destination: "/e/first.txt"}},
+		},
+		{
+			name:  "deleted line",
+			input: "# comment\n1\t000002.txt\n",
+			want:  []renby.Mapping{{Source: "/d/b.txt", Destination: "000002.txt"}},
+		},
+		{
+			name:  "name with spaces",
+			input: "0\t my file .txt\n",
+			want:  []renby.Mapping{{Source: "/d/a.txt", Destination: " my file .txt"}},
+		},
+		{name: "everything deleted", input: editHeader},
+		{name: "missing tab", input: "0 000001.txt\n", wantErr: true},
+		{name: "invalid index", input: "x\t000001.txt\n", wantErr: true},
+		{name: "unknown index", input: "2\t000003.txt\n", wantErr: true},
+		{name: "duplicate index", input: "0\ta.txt\n0\tb.txt\n", wantErr: true},
+		{name: "empty destination", input: "0\t\n", wantErr: true},
+		{name: "empty destination after source", input: "0\t/d/a.txt\t\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEditList(strings.NewReader(tt.input), plan)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEditList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEditList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditSubcommand(t *testing.T) {
+	if _, err := exec.LookPath("sed"); err != nil {
+		t.Skip("sed not available")
+	}
+	tmpDir := t.TempDir()
+	a, b := filepath.Join(tmpDir, "a.txt"), filepath.Join(tmpDir, "b.txt")
+	for i, f := range []string{a, b} {
+		if err := os.WriteFile(f, make([]byte, i+1), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the "editor" renames the second file and keeps the first one
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "sed -i -e s/000002/second/ -e /^0\\t/d")
+	if err := run([]string{"renby", "edit", "size", "--no-journal", a, b}); err != nil {
+		t.Fatalf("edit error = %v", err)
+	}
+	for _, name := range []string{"a.txt", "second.txt"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("%s missing after edit: %v", name, err)
+		}
+	}
+
+	t.Setenv("EDITOR", "false")
+	if err := run([]string{"renby", "edit", "--no-journal", a}); err == nil {
+		t.Error("failing editor: error = nil, want error")
+	}
+	if _, err := os.Stat(a); err != nil {
+		t.Errorf("failing editor must not rename: %v", err)
+	}
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime/debug"
+	"strings"
 
 	"github.com/hidez8891/go-renby"
 	"github.com/spf13/pflag"
@@ -23,13 +28,43 @@ var (
 
 type config struct {
 	reverse        bool
+	sortKeys       string
 	pattern        string
+	template       string
+	counterStyle   string
 	pre            string
 	post           string
 	forceOverwrite bool
+	dryRun         bool
+	ignoreCase     bool
+	fullPath       bool
+	noExifFallback bool
+	journalDir     string
+	noJournal      bool
+	recursive      bool
+	include        []string
+	exclude        []string
+	maxDepth       int
+	followSymlinks bool
+	hidden         bool
+	output         string
+	fromFile       string
+	nulDelimited   bool
 	help           bool
 	version        bool
 	init           int
+	step           int
+	descending     bool
+	autoWidth      bool
+	appendMode     bool
+	skipConforming bool
+	closeGaps      bool
+	groupBy        string
+	sidecars       bool
+	primaryExts    []string
+	outDir         string
+	mode           string
+	export         string
 	filePatterns   []string
 }
 
@@ -61,6 +96,26 @@ func run(args []string) error {
 
 	// Validate subcommand
 	subCmd := args[1]
+	switch subCmd {
+	case "undo":
+		return runUndo(args[0], args[2:])
+	case "recover":
+		return runRecover(args[0], args[2:])
+	case "apply":
+		return runApply(args[0], args[2:])
+	}
+
+	// "plan [SUBCOMMAND]" exports the plan instead of applying it,
+	// "edit [SUBCOMMAND]" opens it in an editor before applying it
+	planOnly := subCmd == "plan"
+	editMode := subCmd == "edit"
+	if planOnly || editMode {
+		args = args[1:]
+		if len(args) < 2 || !isValidSubCmd(args[1]) {
+			args = append([]string{args[0], "ctime"}, args[1:]...)
+		}
+		subCmd = args[1]
+	}
 	if !isValidSubCmd(subCmd) {
 		return fmt.Errorf("invalid subcommand '%s'", subCmd)
 	}
@@ -82,25 +137,144 @@ func run(args []string) error {
 		os.Exit(exitSuccess)
 		return nil
 	}
+	if planOnly && cfg.export == "" {
+		return fmt.Errorf("plan requires --export")
+	}
+	if !planOnly && cfg.export != "" {
+		return fmt.Errorf("--export is only valid with plan")
+	}
 
 	// Process files
-	files, err := processFilePatterns(cfg.filePatterns)
+	var walk *renby.WalkOptions
+	if cfg.recursive {
+		walk = &renby.WalkOptions{
+			Include:        cfg.include,
+			Exclude:        cfg.exclude,
+			MaxDepth:       cfg.maxDepth,
+			FollowSymlinks: cfg.followSymlinks,
+			Hidden:         cfg.hidden,
+		}
+	}
+	var listed []string
+	if cfg.fromFile != "" {
+		listed, err = readFileList(cfg.fromFile, cfg.nulDelimited)
+		if err != nil {
+			return err
+		}
+	}
+	files, err := processFilePatterns(cfg.filePatterns, listed, walk)
 	if err != nil {
 		return err
 	}
 
 	// Execute renaming
 	opts := renby.Options{
-		Pre:            cfg.pre,
-		Post:           cfg.post,
-		Pattern:        cfg.pattern,
-		Reverse:        cfg.reverse,
-		FileMode:       parseSortMode(subCmd),
-		Init:           cfg.init,
-		ForceOverwrite: cfg.forceOverwrite,
+		Pre:                 cfg.pre,
+		Post:                cfg.post,
+		Pattern:             cfg.pattern,
+		Template:            cfg.template,
+		Reverse:             cfg.reverse,
+		FileMode:            parseSortMode(subCmd),
+		Init:                cfg.init,
+		Step:                cfg.step,
+		Descending:          cfg.descending,
+		AutoWidth:           cfg.autoWidth,
+		Append:              cfg.appendMode,
+		SkipConforming:      cfg.skipConforming,
+		CloseGaps:           cfg.closeGaps,
+		Sidecars:            cfg.sidecars,
+		PrimaryExts:         cfg.primaryExts,
+		ForceOverwrite:      cfg.forceOverwrite,
+		IgnoreCase:          cfg.ignoreCase,
+		FullPath:            cfg.fullPath,
+		CaptureTimeFallback: !cfg.noExifFallback,
+	}
+	if cfg.counterStyle != "" {
+		style, err := renby.ParseCounterStyle(cfg.counterStyle)
+		if err != nil {
+			return err
+		}
+		opts.Counter = style
+	}
+	if cfg.sortKeys != "" {
+		opts.SortKeys, err = renby.ParseSortKeys(cfg.sortKeys)
+		if err != nil {
+			return err
+		}
+	}
+	opts.Mode, err = renby.ParseMode(cfg.mode)
+	if err != nil {
+		return err
+	}
+	if cfg.outDir != "" {
+		opts.OutDir, err = filepath.Abs(cfg.outDir)
+		if err != nil {
+			return fmt.Errorf("could not get absolute path for '%s': %v", cfg.outDir, err)
+		}
+	}
+	opts.Group, err = parseGroupBy(cfg.groupBy, opts.SortTime())
+	if err != nil {
+		return err
+	}
+	if !cfg.noJournal {
+		opts.JournalDir, err = resolveJournalDir(cfg.journalDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	plan, err := renby.BuildPlan(files, opts)
+	if err != nil {
+		return err
+	}
+	for _, warning := range plan.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
 	}
 
-	return renby.RenameFiles(files, opts)
+	if planOnly {
+		return exportPlan(cfg.export, plan)
+	}
+	if editMode {
+		mappings, err := editPlan(plan)
+		if err != nil {
+			return err
+		}
+		if len(mappings) == 0 {
+			fmt.Fprintln(os.Stderr, "nothing to rename")
+			return nil
+		}
+		plan, err = renby.PlanFromMappings(mappings, opts)
+		if err != nil {
+			return err
+		}
+	}
+	return applyPlan(plan, opts.ForceOverwrite, cfg.dryRun, cfg.output)
+}
+
+// applyPlan applies the plan, or only prints it on a dry run,
+// and writes the requested output
+func applyPlan(plan *renby.Plan, force, dryRun bool, output string) error {
+	if dryRun {
+		if output != "" {
+			if err := writeOutput(os.Stdout, output, plan, force, true, nil); err != nil {
+				return err
+			}
+		} else {
+			printPlan(os.Stdout, plan)
+		}
+		if plan.HasConflicts() && !force {
+			return fmt.Errorf("dry run: %d conflict(s) detected, renaming would fail", len(plan.Conflicts))
+		}
+		return nil
+	}
+
+	err := plan.Apply(context.Background())
+	if output != "" {
+		if oerr := writeOutput(os.Stdout, output, plan, force, false, err); oerr != nil && err == nil {
+			return oerr
+		}
+	}
+	return err
 }
 
 func parseFlags(name string, args []string) (*config, error) {
@@ -108,29 +282,317 @@ func parseFlags(name string, args []string) (*config, error) {
 
 	cfg := &config{}
 	flags.BoolVarP(&cfg.reverse, "reverse", "r", false, "reverse order")
-	flags.StringVarP(&cfg.pattern, "pattern", "p", defaultPattern, "rename pattern (0: decimal, x: hexadecimal)")
+	flags.StringVar(&cfg.sortKeys, "sort", "", "sort keys, e.g. mtime,-size,name (overrides SUBCOMMAND order)")
+	flags.StringVarP(&cfg.pattern, "pattern", "p", defaultPattern, "rename pattern (0: decimal, x/X: hexadecimal, a/A: alphabetic, z/Z: base36, i/I: roman)")
+	flags.StringVarP(&cfg.template, "template", "t", "", "naming template, e.g. {n:04}_{name}{ext} (replaces pattern, pre and post)")
+	flags.StringVar(&cfg.counterStyle, "counter-style", "", "counter style overriding pattern and template (decimal, hex, upper-hex, lower-alpha, upper-alpha, base36, upper-base36, lower-roman, upper-roman)")
 	flags.IntVar(&cfg.init, "init", 1, "initial number (non-negative)")
+	flags.IntVar(&cfg.step, "step", 1, "counter increment (positive)")
+	flags.BoolVar(&cfg.descending, "descending", false, "count down from --init instead of up")
+	flags.BoolVar(&cfg.autoWidth, "auto-width", false, "pad counters to the width of the largest counter instead of the pattern length")
+	flags.BoolVar(&cfg.appendMode, "append", false, "keep files already named by the pattern and number the others after the highest existing counter")
+	flags.BoolVar(&cfg.skipConforming, "skip-conforming", false, "keep files already named by the pattern and give the others the lowest free counters")
+	flags.BoolVar(&cfg.closeGaps, "close-gaps", false, "renumber files already named by the pattern to close gaps, then number the others")
 	flags.StringVar(&cfg.pre, "pre", "", "prefix string")
 	flags.StringVar(&cfg.post, "post", "", "postfix string")
 	flags.BoolVar(&cfg.forceOverwrite, "force", false, "allow overwriting existing destination files (performs a safe two-phase rename)")
+	flags.BoolVarP(&cfg.dryRun, "dry-run", "n", false, "show renames without performing them")
+	flags.BoolVarP(&cfg.ignoreCase, "ignore-case", "i", false, "compare names case-insensitively (name)")
+	flags.BoolVar(&cfg.fullPath, "full-path", false, "compare full paths instead of base names (name)")
+	flags.BoolVar(&cfg.noExifFallback, "no-exif-fallback", false, "fail on files without EXIF capture date instead of using mtime (exif)")
+	flags.StringVar(&cfg.journalDir, "journal-dir", "", "directory for undo journals")
+	flags.BoolVar(&cfg.noJournal, "no-journal", false, "do not record an undo journal")
+	flags.StringVar(&cfg.groupBy, "group-by", "", "number each group with its own sequence (dir, ext, day, month, year)")
+	flags.BoolVar(&cfg.sidecars, "sidecars", false, "rename files sharing a stem together with their primary file")
+	flags.StringSliceVar(&cfg.primaryExts, "primary-ext", nil, "extensions chosen as primary file, in priority order (sidecars)")
+	flags.StringVar(&cfg.outDir, "out-dir", "", "put the numbered files into this directory, created if needed")
+	flags.StringVar(&cfg.mode, "mode", "move", "how files reach their new names (move, copy, hardlink, symlink)")
+	flags.BoolVarP(&cfg.recursive, "recursive", "R", false, "rename files in directories and their subdirectories")
+	flags.StringSliceVar(&cfg.include, "include", nil, "only rename files matching these globs (recursive, ** matches directories)")
+	flags.StringSliceVar(&cfg.exclude, "exclude", nil, "skip files and directories matching these globs (recursive)")
+	flags.IntVar(&cfg.maxDepth, "max-depth", 0, "levels of directories to descend into, 0: unlimited (recursive)")
+	flags.BoolVar(&cfg.followSymlinks, "follow-symlinks", false, "follow symbolic links instead of skipping them (recursive)")
+	flags.BoolVar(&cfg.hidden, "hidden", false, "include hidden files and directories (recursive)")
+	flags.StringVar(&cfg.export, "export", "", "write the plan to a CSV (or .tsv) manifest instead of renaming (plan)")
+	flags.StringVar(&cfg.output, "output", "", "print the renames as json or jsonl")
+	flags.StringVar(&cfg.fromFile, "from-file", "", "read file names, one per line, from PATH or - for stdin")
+	flags.BoolVarP(&cfg.nulDelimited, "null", "0", false, "file names read by --from-file are separated by NUL")
 	flags.BoolVar(&cfg.help, "help", false, "show help")
 	flags.BoolVar(&cfg.version, "version", false, "show version")
 
 	if err := flags.Parse(args); err != nil {
 		return nil, err
 	}
+	if !isValidOutput(cfg.output) {
+		return nil, fmt.Errorf("unknown output format '%s'", cfg.output)
+	}
+	if cfg.step < 1 {
+		return nil, fmt.Errorf("--step must be positive")
+	}
+	if cfg.nulDelimited && cfg.fromFile == "" {
+		return nil, fmt.Errorf("--null requires --from-file")
+	}
+	if !cfg.recursive && (len(cfg.include) > 0 || len(cfg.exclude) > 0 || cfg.maxDepth != 0 || cfg.followSymlinks || cfg.hidden) {
+		return nil, fmt.Errorf("--include, --exclude, --max-depth, --follow-symlinks and --hidden require --recursive")
+	}
 
 	// Store remaining args as file patterns
 	cfg.filePatterns = flags.Args()
-	if len(cfg.filePatterns) == 0 {
+	if len(cfg.filePatterns) == 0 && cfg.fromFile == "" {
 		return nil, fmt.Errorf("file pattern required")
 	}
 
 	return cfg, nil
 }
 
-func processFilePatterns(patterns []string) ([]string, error) {
-	var files []string
+// runApply executes the renames listed in a CSV or TSV manifest
+func runApply(name string, args []string) error {
+	flags := pflag.NewFlagSet(name, pflag.ExitOnError)
+
+	var force, dryRun, noJournal, help bool
+	var journalDir, output string
+	flags.BoolVar(&force, "force", false, "allow overwriting existing destination files (performs a safe two-phase rename)")
+	flags.BoolVarP(&dryRun, "dry-run", "n", false, "show renames without performing them")
+	flags.StringVar(&journalDir, "journal-dir", "", "directory for undo journals")
+	flags.BoolVar(&noJournal, "no-journal", false, "do not record an undo journal")
+	flags.StringVar(&output, "output", "", "print the renames as json or jsonl")
+	flags.BoolVar(&help, "help", false, "show help")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if help {
+		showHelp()
+		os.Exit(exitSuccess)
+		return nil
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("apply requires exactly one manifest")
+	}
+	if !isValidOutput(output) {
+		return fmt.Errorf("unknown output format '%s'", output)
+	}
+
+	mappings, err := readManifest(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	opts := renby.Options{ForceOverwrite: force}
+	if !noJournal {
+		opts.JournalDir, err = resolveJournalDir(journalDir)
+		if err != nil {
+			return err
+		}
+	}
+	plan, err := renby.PlanFromMappings(mappings, opts)
+	if err != nil {
+		return err
+	}
+	return applyPlan(plan, force, dryRun, output)
+}
+
+// manifestComma returns the field separator of a manifest: tab for
+// .tsv and .tab files, comma otherwise
+func manifestComma(path string) rune {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tsv", ".tab":
+		return '\t'
+	default:
+		return ','
+	}
+}
+
+// exportPlan writes the plan to the manifest at path, or stdout for "-"
+func exportPlan(path string, plan *renby.Plan) error {
+	if path == "-" {
+		return renby.WriteManifest(os.Stdout, plan, ',')
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not write manifest: %v", err)
+	}
+	if err := renby.WriteManifest(file, plan, manifestComma(path)); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write manifest: %v", err)
+	}
+	return file.Close()
+}
+
+// readManifest reads the manifest at path, or stdin for "-"
+func readManifest(path string) ([]renby.Mapping, error) {
+	if path == "-" {
+		return renby.ReadManifest(os.Stdin, ',')
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest: %v", err)
+	}
+	defer file.Close()
+	return renby.ReadManifest(file, manifestComma(path))
+}
+
+// runUndo reverses the most recent or the given rename batch
+func runUndo(name string, args []string) error {
+	flags := pflag.NewFlagSet(name, pflag.ExitOnError)
+
+	var journalDir string
+	var help bool
+	flags.StringVar(&journalDir, "journal-dir", "", "directory for undo journals")
+	flags.BoolVar(&help, "help", false, "show help")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if help {
+		showHelp()
+		os.Exit(exitSuccess)
+		return nil
+	}
+	if flags.NArg() > 1 {
+		return fmt.Errorf("too many arguments for undo")
+	}
+
+	journal := flags.Arg(0)
+	if journal == "" {
+		dir, err := resolveJournalDir(journalDir)
+		if err != nil {
+			return err
+		}
+		journal, err = renby.LatestJournal(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return renby.Undo(journal)
+}
+
+// runRecover completes or reverts batches interrupted in a directory
+func runRecover(name string, args []string) error {
+	flags := pflag.NewFlagSet(name, pflag.ExitOnError)
+
+	var complete, revert, help bool
+	flags.BoolVar(&complete, "complete", false, "finish interrupted batches")
+	flags.BoolVar(&revert, "revert", false, "restore original names of interrupted batches")
+	flags.BoolVar(&help, "help", false, "show help")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if help {
+		showHelp()
+		os.Exit(exitSuccess)
+		return nil
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("recover requires exactly one directory")
+	}
+	if complete && revert {
+		return fmt.Errorf("--complete and --revert are mutually exclusive")
+	}
+
+	mode := renby.RecoverAuto
+	if complete {
+		mode = renby.RecoverComplete
+	} else if revert {
+		mode = renby.RecoverRevert
+	}
+
+	report, err := renby.Recover(flags.Arg(0), mode)
+	if report != nil {
+		for _, orphan := range report.Orphans {
+			fmt.Fprintf(os.Stderr, "Warning: no intent log for temp file '%s'\n", orphan)
+		}
+		fmt.Printf("completed %d batch(es), reverted %d batch(es)\n", report.Completed, report.Reverted)
+	}
+	return err
+}
+
+// parseGroupBy returns the grouping for a --group-by value, nil when empty.
+// Date groups use the timestamp mode the files are sorted by.
+func parseGroupBy(name string, mode renby.SortMode) (renby.GroupFunc, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "dir":
+		return renby.GroupByDir, nil
+	case "ext":
+		return renby.GroupByExt, nil
+	case "day":
+		return renby.GroupByDay(mode), nil
+	case "month":
+		return renby.GroupByMonth(mode), nil
+	case "year":
+		return renby.GroupByYear(mode), nil
+	default:
+		return nil, fmt.Errorf("unknown group '%s'", name)
+	}
+}
+
+// resolveJournalDir returns dir, or the default journal directory when empty
+func resolveJournalDir(dir string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("could not determine journal directory: %v", err)
+	}
+	return filepath.Join(cacheDir, "renby", "journal"), nil
+}
+
+// readFileList reads the file names listed in path, or stdin for "-",
+// separated by newlines or, with nul set, by NUL characters
+func readFileList(path string, nul bool) ([]string, error) {
+	r := os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read file list: %v", err)
+		}
+		defer file.Close()
+		r = file
+	}
+	return parseFileList(r, nul)
+}
+
+// parseFileList splits a file list, skipping empty entries
+func parseFileList(r io.Reader, nul bool) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if nul {
+		scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+			if i := bytes.IndexByte(data, 0); i >= 0 {
+				return i + 1, data[:i], nil
+			}
+			if atEOF && len(data) > 0 {
+				return len(data), data, nil
+			}
+			return 0, nil, nil
+		})
+	}
+
+	var names []string
+	for scanner.Scan() {
+		name := scanner.Text()
+		if !nul {
+			name = strings.TrimSuffix(name, "\r")
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read file list: %v", err)
+	}
+	return names, nil
+}
+
+// processFilePatterns expands the patterns into files and adds the listed
+// file names, which are used as is. With walk set, matched and listed
+// directories are walked recursively.
+func processFilePatterns(patterns, listed []string, walk *renby.WalkOptions) ([]string, error) {
+	var paths []string
 	for _, pat := range patterns {
 		matches, err := filepath.Glob(pat)
 		if err != nil {
@@ -140,7 +602,25 @@ func processFilePatterns(patterns []string) ([]string, error) {
 			fmt.Fprintf(os.Stderr, "Warning: no files match pattern '%s'\n", pat)
 			continue
 		}
-		files = append(files, matches...)
+		paths = append(paths, matches...)
+	}
+	paths = append(paths, listed...)
+
+	var files []string
+	for _, path := range paths {
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		if walk == nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping directory '%s' (use --recursive)\n", path)
+			continue
+		}
+		walked, err := renby.Walk(path, *walk)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, walked...)
 	}
 	if len(files) == 0 {
 		return nil, fmt.Errorf("no files found")
@@ -149,6 +629,29 @@ func processFilePatterns(patterns []string) ([]string, error) {
 	return removeDuplicates(files)
 }
 
+// printPlan writes the planned renames and conflicts without touching files
+func printPlan(w io.Writer, plan *renby.Plan) {
+	for _, e := range plan.Entries {
+		fmt.Fprintf(w, "%s -> %s\n", displayPath(e.Source), displayPath(e.Destination))
+	}
+	for _, c := range plan.Conflicts {
+		fmt.Fprintf(w, "conflict: %s\n", c)
+	}
+}
+
+// displayPath returns path relative to the working directory when possible
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
 func removeDuplicates(files []string) ([]string, error) {
 	savedFiles := make([]string, 0, len(files))
 	uniqueFiles := make(map[string]struct{})
@@ -168,7 +671,7 @@ func removeDuplicates(files []string) ([]string, error) {
 }
 
 func isValidSubCmd(cmd string) bool {
-	validCmds := []string{"ctime", "mtime", "atime", "size"}
+	validCmds := []string{"ctime", "chtime", "mtime", "atime", "size", "name", "exif"}
 	for _, valid := range validCmds {
 		if cmd == valid {
 			return true
@@ -181,12 +684,18 @@ func parseSortMode(cmd string) renby.SortMode {
 	switch cmd {
 	case "ctime":
 		return renby.SortByCreationTime
+	case "chtime":
+		return renby.SortByChangeTime
 	case "mtime":
 		return renby.SortByModificationTime
 	case "atime":
 		return renby.SortByAccessTime
 	case "size":
 		return renby.SortBySize
+	case "name":
+		return renby.SortByName
+	case "exif":
+		return renby.SortByCaptureTime
 	default:
 		return renby.SortByCreationTime
 	}
@@ -194,22 +703,116 @@ func parseSortMode(cmd string) renby.SortMode {
 
 func showHelp() {
 	fmt.Println(`Usage: renby SUBCOMMAND [OPTIONS] FILES...
+       renby SUBCOMMAND [OPTIONS] --from-file=PATH [FILES...]
+       renby plan [SUBCOMMAND] [OPTIONS] --export=MANIFEST FILES...
+       renby edit [SUBCOMMAND] [OPTIONS] FILES...
+       renby apply [--force] [-n] [--output=FORMAT] MANIFEST
+       renby undo [--journal-dir=DIR] [JOURNAL]
+       renby recover [--complete|--revert] DIR
 
 SUBCOMMAND:
-  ctime     sort by creation time
+  ctime     sort by creation (birth) time
+  chtime    sort by inode change time
   mtime     sort by modification time
   atime     sort by access time
   size      sort by file size
+  name      sort by file name (natural order: scan2 < scan10)
+  exif      sort by EXIF capture date of JPEG/TIFF images
+  plan      write the renames of SUBCOMMAND (default: ctime) to a CSV
+            manifest (TSV for .tsv files, stdout for -) to review and edit
+  edit      open the renames of SUBCOMMAND (default: ctime) in $VISUAL or
+            $EDITOR (default: vi), one "INDEX<TAB>SOURCE<TAB>DESTINATION"
+            line per file, then apply the edited destinations; deleted
+            lines keep their names
+  apply     rename every source of a manifest to its destination; relative
+            destinations are resolved against the source directory
+  undo      reverse the most recent (or the given) rename batch
+  recover   complete or revert a --force batch interrupted in DIR
+            (default: complete if it reached phase two, revert otherwise)
 
 OPTIONS:
   -r, --reverse         reverse sort order
-  -p, --pattern=STRING  rename pattern (0: decimal, x: hexadecimal)
+  --sort=KEYS           comma separated sort keys replacing the SUBCOMMAND order
+                        (ctime, chtime, mtime, atime, size, name, exif; '-' prefix: descending)
+                        ties are always broken by path
+  -p, --pattern=STRING  rename pattern; its length sets the zero-padded width
+                        and a style character selects the counter style:
+                        0: decimal, x/X: hexadecimal, a/A: alphabetic (a..z, aa),
+                        z/Z: base36, i/I: roman numerals (1 to 3999)
                         default: 000000
+  -t, --template=STRING naming template replacing --pattern, --pre and --post
+                        {n} {n:04} {n:4X}  counter (zero-padded, style character as in --pattern)
+                        {name} {ext} {dir} original stem, extension, parent dir
+                        {size}             file size in bytes
+                        {mtime:LAYOUT}     timestamp in Go layout (default 20060102)
+                                           also ctime, chtime, atime, exif
+                        {time:LAYOUT}      timestamp the files are sorted by
+                        {{ }}              literal braces
+  --counter-style=NAME  counter style overriding --pattern and --template:
+                        decimal, hex, upper-hex, lower-alpha, upper-alpha,
+                        base36, upper-base36, lower-roman, upper-roman
   --init=NUMBER         initial number (non-negative)
                         default: 1
+  --step=NUMBER         counter increment (positive), e.g. 10 to leave gaps
+                        default: 1
+  --descending          count down from --init by --step instead of up
+  --auto-width          pad counters to the width of the largest counter
+                        (1200 files: 4 digits) instead of the pattern length
+  --append              keep files whose names already match the pattern,
+                        prefix and postfix (or template) and number the other
+                        files after the highest counter found in their directory
+  --skip-conforming     keep files whose names already match and give the other
+                        files the lowest free counters (reruns change nothing)
+  --close-gaps          renumber files whose names already match in the order of
+                        their counters so the sequence has no gaps, then number
+                        the other files
   --pre=STRING          prefix string
   --post=STRING         postfix string
   --force               allow overwriting existing destination files (performs a safe two-phase rename)
+  -n, --dry-run         show renames without performing them
+  -i, --ignore-case     compare names case-insensitively (name)
+  --full-path           compare full paths instead of base names (name)
+  --no-exif-fallback    fail on files without EXIF capture date
+                        instead of using their modification time (exif)
+  --journal-dir=DIR     directory for undo journals
+                        default: <user cache dir>/renby/journal
+  --no-journal          do not record an undo journal
+  --out-dir=DIR         put the numbered files into DIR instead of the directory of
+                        each file; DIR is created if needed
+  --mode=MODE           how files reach their new names
+                        move:     rename the files (default)
+                        copy:     copy content, permissions and timestamps
+                        hardlink: link the new names to the files (same
+                                  filesystem only)
+                        symlink:  create symbolic links to the files
+                        copy and links keep the original files untouched
+  --group-by=GROUP      number each group with its own sequence starting at --init
+                        dir:   parent directory
+                        ext:   file extension (case-insensitive)
+                        day, month, year: calendar date of the timestamp the
+                               files are sorted by (mtime when not sorted by time)
+  --sidecars            treat files sharing a directory and a stem (IMG_1.CR2,
+                        IMG_1.jpg, IMG_1.xmp) as one unit: sorted by the primary
+                        file, given one counter, each keeping its extension
+  --primary-ext=EXTS    comma separated extensions chosen as primary file, in
+                        priority order (sidecars)
+                        default: raw formats, then jpg, heic, tif, png, mov, mp4
+  --output=FORMAT       print every entry (source, destination, key, index, status)
+                        and a summary on stdout, also for --dry-run
+                        json: one document, jsonl: one object per line
+  --from-file=PATH      also rename the files listed in PATH, one per line;
+                        - reads the list from stdin
+  -0, --null            the list of --from-file is separated by NUL characters
+                        (find -print0, fd -0)
+  -R, --recursive       rename files in matched directories and their subdirectories
+  --include=GLOBS       only rename files matching one of the comma separated globs;
+                        a glob without '/' matches the file name, otherwise the path
+                        below the directory, where ** matches any directories
+                        e.g. --include='*.jpg,shoot/**/*.cr2' (recursive)
+  --exclude=GLOBS       skip files and whole directories matching the globs (recursive)
+  --max-depth=NUMBER    levels of directories to descend into, 0: unlimited (recursive)
+  --follow-symlinks     follow symbolic links instead of skipping them (recursive)
+  --hidden              include hidden files and directories (recursive)
   --help                show this help
   --version             show version
 
@@ -217,7 +820,28 @@ Example:
   renby ctime *.png
   renby size -r --pre=img --post=test *.jpg
   renby size -p=xxx *.txt
-  renby size --init=100 *.txt`)
+  renby size --init=100 *.txt
+  renby mtime --step=10 --auto-width *.jpg
+  renby name --descending --init=50 *.txt
+  renby ctime --append *.png
+  renby mtime --skip-conforming *.jpg
+  renby mtime -R --include='*.jpg' --exclude=thumbs projects
+  renby name -R --group-by=dir chapters
+  renby exif --out-dir=/mnt/usb/trip --mode=copy *.jpg
+  find . -name '*.jpg' -print0 | renby mtime --from-file=- -0
+  renby mtime -n --output=jsonl *.jpg
+  renby exif --sidecars *.CR2 *.jpg *.xmp
+  renby exif --group-by=day -t '{time:2006-01-02}_{n:03}{ext}' *.jpg *.cr2
+  renby name -t 'chapter_{n:I}{ext}' *.md
+  renby ctime -n *.png
+  renby name -i scan*.png
+  renby mtime --sort=mtime,-size,name *.jpg
+  renby exif --pre=trip_ *.jpg
+  renby mtime -t '{n:04}_{name}_{mtime:2006-01-02}{ext}' *.jpg
+  renby plan mtime --export=mapping.csv *.jpg
+  renby apply mapping.csv
+  renby edit name -t 'ch{n:02}{ext}' *.md
+  renby undo`)
 }
 
 func showVersion() {
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/hidez8891/go-renby"
 )
 
 func TestParseFlags(t *testing.T) {
@@ -27,6 +30,8 @@ func TestParseFlags(t *testing.T) {
 				help:         false,
 				version:      false,
 				init:         1,
+				step:         1,
+				mode:         "move",
 				filePatterns: []string{"*.png"},
 			},
 			wantErr: false,
@@ -42,6 +47,8 @@ func TestParseFlags(t *testing.T) {
 				help:         false,
 				version:      false,
 				init:         1,
+				step:         1,
+				mode:         "move",
 				filePatterns: []string{"*.jpg"},
 			},
 			wantErr: false,
@@ -57,10 +64,178 @@ func TestParseFlags(t *testing.T) {
 				help:         false,
 				version:      false,
 				init:         1,
+				step:         1,
+				mode:         "move",
 				filePatterns: []string{"*.txt"},
 			},
 			wantErr: false,
 		},
+		{
+			name: "counter style",
+			args: []string{"--counter-style=upper-roman", "*.md"},
+			want: &config{
+				pattern:      defaultPattern,
+				counterStyle: "upper-roman",
+				init:         1,
+				step:         1,
+				mode:         "move",
+				filePatterns: []string{"*.md"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "step, descending and auto width",
+			args: []string{"--step=10", "--descending", "--init=100", "--auto-width", "*.txt"},
+			want: &config{
+				pattern:      defaultPattern,
+				init:         100,
+				step:         10,
+				mode:         "move",
+				descending:   true,
+				autoWidth:    true,
+				filePatterns: []string{"*.txt"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "out dir and copy mode",
+			args: []string{"--out-dir=numbered", "--mode=copy", "*.jpg"},
+			want: &config{
+				pattern:      defaultPattern,
+				init:         1,
+				step:         1,
+				outDir:       "numbered",
+				mode:         "copy",
+				filePatterns: []string{"*.jpg"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "append",
+			args: []string{"--append", "*.png"},
+			want: &config{
+				pattern:      defaultPattern,
+				init:         1,
+				step:         1,
+				mode:         "move",
+				appendMode:   true,
+				filePatterns: []string{"*.png"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "skip conforming and close gaps",
+			args: []string{"--skip-conforming", "--close-gaps", "*.jpg"},
+			want: &config{
+				pattern:        defaultPattern,
+				init:           1,
+				step:           1,
+				mode:           "move",
+				skipConforming: true,
+				closeGaps:      true,
+				filePatterns:   []string{"*.jpg"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "recursive",
+			args: []string{"-R", "--include=*.jpg,*.png", "--exclude=thumbs", "--max-depth=2", "--hidden", "photos"},
+			want: &config{
+				pattern:      defaultPattern,
+				init:         1,
+				step:         1,
+				mode:         "move",
+				recursive:    true,
+				include:      []string{"*.jpg", "*.png"},
+				exclude:      []string{"thumbs"},
+				maxDepth:     2,
+				hidden:       true,
+				filePatterns: []string{"photos"},
+			},
+			wantErr: false,
+		},
+		{
+			name:        "walk options without recursion",
+			args:        []string{"--include=*.jpg", "photos"},
+			want:        nil,
+			wantErr:     true,
+			errContains: "--include, --exclude",
+		},
+		{
+			name: "group by",
+			args: []string{"--group-by=dir", "*.txt"},
+			want: &config{
+				pattern:      defaultPattern,
+				init:         1,
+				step:         1,
+				mode:         "move",
+				groupBy:      "dir",
+				filePatterns: []string{"*.txt"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "sidecars",
+			args: []string{"--sidecars", "--primary-ext=cr2,jpg", "*"},
+			want: &config{
+				pattern:      defaultPattern,
+				init:         1,
+				step:         1,
+				mode:         "move",
+				sidecars:     true,
+				primaryExts:  []string{"cr2", "jpg"},
+				filePatterns: []string{"*"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "from file",
+			args: []string{"--from-file=-", "-0"},
+			want: &config{
+				pattern:      defaultPattern,
+				init:         1,
+				step:         1,
+				mode:         "move",
+				fromFile:     "-",
+				nulDelimited: true,
+				filePatterns: []string{},
+			},
+			wantErr: false,
+		},
+		{
+			name:        "null without from file",
+			args:        []string{"-0", "*.txt"},
+			want:        nil,
+			wantErr:     true,
+			errContains: "--null requires --from-file",
+		},
+		{
+			name: "json output",
+			args: []string{"--output=jsonl", "*.txt"},
+			want: &config{
+				pattern:      defaultPattern,
+				init:         1,
+				step:         1,
+				mode:         "move",
+				output:       "jsonl",
+				filePatterns: []string{"*.txt"},
+			},
+			wantErr: false,
+		},
+		{
+			name:        "unknown output",
+			args:        []string{"--output=xml", "*.txt"},
+			want:        nil,
+			wantErr:     true,
+			errContains: "unknown output format",
+		},
+		{
+			name:        "zero step",
+			args:        []string{"--step=0", "*.txt"},
+			want:        nil,
+			wantErr:     true,
+			errContains: "--step must be positive",
+		},
 		{
 			name: "decimal pattern",
 			args: []string{"-p=000", "*.txt"},
@@ -72,6 +247,8 @@ func TestParseFlags(t *testing.T) {
 				help:         false,
 				version:      false,
 				init:         1,
+				step:         1,
+				mode:         "move",
 				filePatterns: []string{"*.txt"},
 			},
 			wantErr: false,
@@ -87,6 +264,8 @@ func TestParseFlags(t *testing.T) {
 				help:         false,
 				version:      false,
 				init:         100,
+				step:         1,
+				mode:         "move",
 				filePatterns: []string{"*.txt"},
 			},
 			wantErr: false,
@@ -102,10 +281,66 @@ func TestParseFlags(t *testing.T) {
 				help:         false,
 				version:      false,
 				init:         1,
+				step:         1,
+				mode:         "move",
 				filePatterns: []string{"*.jpg", "*.png"},
 			},
 			wantErr: false,
 		},
+		{
+			name: "sort keys",
+			args: []string{"--sort=mtime,-size,name", "*.jpg"},
+			want: &config{
+				reverse:      false,
+				sortKeys:     "mtime,-size,name",
+				pattern:      defaultPattern,
+				pre:          "",
+				post:         "",
+				help:         false,
+				version:      false,
+				init:         1,
+				step:         1,
+				mode:         "move",
+				filePatterns: []string{"*.jpg"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "template",
+			args: []string{"-t", "{n:04}_{name}{ext}", "*.jpg"},
+			want: &config{
+				reverse:      false,
+				pattern:      defaultPattern,
+				template:     "{n:04}_{name}{ext}",
+				pre:          "",
+				post:         "",
+				help:         false,
+				version:      false,
+				init:         1,
+				step:         1,
+				mode:         "move",
+				filePatterns: []string{"*.jpg"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "dry run",
+			args: []string{"-n", "*.txt"},
+			want: &config{
+				reverse:      false,
+				pattern:      defaultPattern,
+				pre:          "",
+				post:         "",
+				dryRun:       true,
+				help:         false,
+				version:      false,
+				init:         1,
+				step:         1,
+				mode:         "move",
+				filePatterns: []string{"*.txt"},
+			},
+			wantErr: false,
+		},
 		{
 			name:        "no file patterns",
 			args:        []string{},
@@ -124,6 +359,8 @@ func TestParseFlags(t *testing.T) {
 				help:         true,
 				version:      false,
 				init:         1,
+				step:         1,
+				mode:         "move",
 				filePatterns: []string{"*.txt"},
 			},
 			wantErr: false,
@@ -139,6 +376,8 @@ func TestParseFlags(t *testing.T) {
 				help:         false,
 				version:      true,
 				init:         1,
+				step:         1,
+				mode:         "move",
 				filePatterns: []string{"*.txt"},
 			},
 			wantErr: false,
@@ -170,7 +409,10 @@ func TestProcessFilePatterns(t *testing.T) {
 	tmpDir := t.TempDir()
 	defer os.RemoveAll(tmpDir)
 
-	files := []string{"test1.txt", "test2.txt", "test.jpg"}
+	files := []string{"test1.txt", "test2.txt", "test.jpg", filepath.Join("sub", "deep", "test3.txt")}
+	if err := os.MkdirAll(filepath.Join(tmpDir, "sub", "deep"), 0755); err != nil {
+		t.Fatal(err)
+	}
 	for _, f := range files {
 		path := filepath.Join(tmpDir, f)
 		if err := os.WriteFile(path, []byte("test"), 0644); err != nil {
@@ -191,6 +433,8 @@ func TestProcessFilePatterns(t *testing.T) {
 	tests := []struct {
 		name        string
 		patterns    []string
+		listed      []string
+		walk        *renby.WalkOptions
 		want        int
 		wantErr     bool
 		errContains string
@@ -213,6 +457,39 @@ func TestProcessFilePatterns(t *testing.T) {
 			want:     3,
 			wantErr:  false,
 		},
+		{
+			name:     "directories skipped without recursion",
+			patterns: []string{"*"},
+			want:     3,
+			wantErr:  false,
+		},
+		{
+			name:     "recursive",
+			patterns: []string{"."},
+			walk:     &renby.WalkOptions{},
+			want:     4,
+			wantErr:  false,
+		},
+		{
+			name:     "recursive include",
+			patterns: []string{"."},
+			walk:     &renby.WalkOptions{Include: []string{"sub/**/*.txt"}},
+			want:     1,
+			wantErr:  false,
+		},
+		{
+			name:     "listed files",
+			patterns: []string{"*.txt"},
+			listed:   []string{"test.jpg", "test1.txt"},
+			want:     3,
+			wantErr:  false,
+		},
+		{
+			name:    "listed files only",
+			listed:  []string{"test.jpg"},
+			want:    1,
+			wantErr: false,
+		},
 		{
 			name:        "invalid pattern",
 			patterns:    []string{"["},
@@ -231,7 +508,7 @@ func TestProcessFilePatterns(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := processFilePatterns(tt.patterns)
+			got, err := processFilePatterns(tt.patterns, tt.listed, tt.walk)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("processFilePatterns() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -248,3 +525,132 @@ func TestProcessFilePatterns(t *testing.T) {
 		})
 	}
 }
+
+func TestParseGroupBy(t *testing.T) {
+	for _, name := range []string{"", "dir", "ext", "day", "month", "year"} {
+		if _, err := parseGroupBy(name, renby.SortByModificationTime); err != nil {
+			t.Errorf("parseGroupBy(%q) error = %v", name, err)
+		}
+	}
+	if group, _ := parseGroupBy("", renby.SortByModificationTime); group != nil {
+		t.Error("parseGroupBy(\"\") should not group")
+	}
+	if _, err := parseGroupBy("planet", renby.SortByModificationTime); err == nil {
+		t.Error("parseGroupBy(\"planet\") error = nil, want error")
+	}
+}
+
+func TestParseFileList(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		nul   bool
+		want  []string
+	}{
+		{name: "newlines", input: "a.jpg\nb c.jpg\r\n\nd.jpg", want: []string{"a.jpg", "b c.jpg", "d.jpg"}},
+		{name: "nul", input: "a.jpg\x00line\nbreak.jpg\x00\x00d.jpg\x00", nul: true, want: []string{"a.jpg", "line\nbreak.jpg", "d.jpg"}},
+		{name: "empty", input: "", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFileList(strings.NewReader(tt.input), tt.nul)
+			if err != nil {
+				t.Fatalf("parseFileList() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFileList() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintPlan(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := []string{filepath.Join(tmpDir, "b.txt"), filepath.Join(tmpDir, "a.txt")}
+	for i, f := range files {
+		if err := os.WriteFile(f, make([]byte, i+1), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "2.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := renby.BuildPlan(files, renby.Options{Pattern: "0", FileMode: renby.SortBySize, Init: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	printPlan(&buf, plan)
+
+	want := files[0] + " -> " + filepath.Join(tmpDir, "1.txt") + "\n" +
+		files[1] + " -> " + filepath.Join(tmpDir, "2.txt") + "\n" +
+		"conflict: destination already exists: \"" + filepath.Join(tmpDir, "2.txt") + "\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("printPlan() = %q, want %q", got, want)
+	}
+
+	// Nothing must be renamed
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("source %s missing after dry run: %v", f, err)
+		}
+	}
+}
+
+func TestPlanExportAndApply(t *testing.T) {
+	tmpDir := t.TempDir()
+	a, b := filepath.Join(tmpDir, "a.txt"), filepath.Join(tmpDir, "b.txt")
+	for i, f := range []string{a, b} {
+		if err := os.WriteFile(f, make([]byte, i+1), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest := filepath.Join(tmpDir, "mapping.tsv")
+
+	if err := run([]string{"renby", "plan", "size", "--export=" + manifest, "--no-journal", a, b}); err != nil {
+		t.Fatalf("plan error = %v", err)
+	}
+	data, err := os.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "index\tsource\tdestination\tkey\n" +
+		"0\t" + a + "\t" + filepath.Join(tmpDir, "000001.txt") + "\t1\n" +
+		"1\t" + b + "\t" + filepath.Join(tmpDir, "000002.txt") + "\t2\n"
+	if string(data) != want {
+		t.Fatalf("manifest = %q, want %q", data, want)
+	}
+	if _, err := os.Stat(a); err != nil {
+		t.Fatalf("plan must not rename: %v", err)
+	}
+
+	// edit a destination and apply the manifest
+	edited := strings.Replace(string(data), filepath.Join(tmpDir, "000002.txt"), "second.txt", 1)
+	if err := os.WriteFile(manifest, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{"renby", "apply", "--no-journal", manifest}); err != nil {
+		t.Fatalf("apply error = %v", err)
+	}
+	for _, name := range []string{"000001.txt", "second.txt"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("%s missing after apply: %v", name, err)
+		}
+	}
+
+	if err := run([]string{"renby", "size", "--export=" + manifest, "--no-journal", a}); err == nil {
+		t.Error("--export without plan: error = nil, want error")
+	}
+}
+
+func TestManifestComma(t *testing.T) {
+	tests := map[string]rune{"m.csv": ',', "m.TSV": '\t', "m.tab": '\t', "m": ','}
+	for path, want := range tests {
+		if got := manifestComma(path); got != want {
+			t.Errorf("manifestComma(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
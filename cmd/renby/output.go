@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hidez8891/go-renby"
+)
+
+// outputVersion is the version of the JSON output schema.
+// Fields may be added within a version but are never renamed or removed.
+const outputVersion = 1
+
+// Entry statuses of the JSON output
+const (
+	statusPlanned    = "planned"     // dry run: would be renamed
+	statusRenamed    = "renamed"     // renamed
+	statusUnchanged  = "unchanged"   // keeps its name
+	statusConflict   = "conflict"    // not renamed: the entry has a conflict
+	statusSkipped    = "skipped"     // not renamed: another entry has a conflict
+	statusRolledBack = "rolled_back" // not renamed: the batch failed and was rolled back
+	statusFailed     = "failed"      // the batch failed and could not be rolled back completely
+)
+
+// outputEntry is the record of a single planned rename
+type outputEntry struct {
+	Type        string   `json:"type"` // always "entry"
+	Index       int      `json:"index"`
+	Source      string   `json:"source"`
+	Destination string   `json:"destination"`
+	Key         string   `json:"key"`
+	Primary     string   `json:"primary,omitempty"`
+	Status      string   `json:"status"`
+	Conflicts   []string `json:"conflicts,omitempty"`
+}
+
+// outputSummary is the record describing the whole batch
+type outputSummary struct {
+	Type      string         `json:"type"` // always "summary"
+	Version   int            `json:"version"`
+	DryRun    bool           `json:"dry_run"`
+	Total     int            `json:"total"`
+	Statuses  map[string]int `json:"statuses"`
+	Conflicts []string       `json:"conflicts"`
+	Warnings  []string       `json:"warnings"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// outputDocument is written by --output=json
+type outputDocument struct {
+	Version int           `json:"version"`
+	Entries []outputEntry `json:"entries"`
+	Summary outputSummary `json:"summary"`
+}
+
+// isValidOutput reports whether format is a known --output value
+func isValidOutput(format string) bool {
+	return format == "" || format == "json" || format == "jsonl"
+}
+
+// writeOutput writes the plan and the result of applying it (applyErr,
+// ignored on dry runs) as a JSON document or as JSON lines
+func writeOutput(w io.Writer, format string, plan *renby.Plan, force, dryRun bool, applyErr error) error {
+	entries := make([]outputEntry, len(plan.Entries))
+	summary := outputSummary{
+		Type:      "summary",
+		Version:   outputVersion,
+		DryRun:    dryRun,
+		Total:     len(plan.Entries),
+		Statuses:  make(map[string]int),
+		Conflicts: make([]string, len(plan.Conflicts)),
+		Warnings:  append([]string{}, plan.Warnings...),
+	}
+	for i, c := range plan.Conflicts {
+		summary.Conflicts[i] = c.String()
+	}
+	if applyErr != nil && !dryRun {
+		summary.Error = applyErr.Error()
+	}
+
+	for i, e := range plan.Entries {
+		entries[i] = outputEntry{
+			Type:        "entry",
+			Index:       e.Index,
+			Source:      e.Source,
+			Destination: e.Destination,
+			Key:         e.Key,
+			Primary:     e.Primary,
+			Status:      entryStatus(e, plan, force, dryRun, applyErr),
+		}
+		for _, c := range e.Conflicts {
+			entries[i].Conflicts = append(entries[i].Conflicts, c.String())
+		}
+		summary.Statuses[entries[i].Status]++
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	switch format {
+	case "json":
+		enc.SetIndent("", "  ")
+		return enc.Encode(outputDocument{Version: outputVersion, Entries: entries, Summary: summary})
+	case "jsonl":
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return enc.Encode(summary)
+	default:
+		return fmt.Errorf("unknown output format '%s'", format)
+	}
+}
+
+// entryStatus returns the status of e after the plan was applied or not
+func entryStatus(e renby.PlanEntry, plan *renby.Plan, force, dryRun bool, applyErr error) string {
+	blocked := plan.HasConflicts() && !force
+	switch {
+	case e.Unchanged():
+		return statusUnchanged
+	case blocked && len(e.Conflicts) > 0:
+		return statusConflict
+	case blocked:
+		return statusSkipped
+	case dryRun:
+		return statusPlanned
+	case applyErr == nil:
+		return statusRenamed
+	}
+
+	var rbErr *renby.RollbackError
+	if errors.As(applyErr, &rbErr) && len(rbErr.Rollback) == 0 {
+		return statusRolledBack
+	}
+	return statusFailed
+}
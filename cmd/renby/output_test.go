@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hidez8891/go-renby"
+)
+
+func TestWriteOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := []string{filepath.Join(tmpDir, "b.txt"), filepath.Join(tmpDir, "a.txt")}
+	for i, f := range files {
+		if err := os.WriteFile(f, make([]byte, i+1), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := renby.Options{Pattern: "0", FileMode: renby.SortBySize, Init: 1}
+
+	plan, err := renby.BuildPlan(files, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// dry run as JSON lines
+	var buf bytes.Buffer
+	if err := writeOutput(&buf, "jsonl", plan, false, true, nil); err != nil {
+		t.Fatalf("writeOutput() error = %v", err)
+	}
+	var records []map[string]any
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 2 entries and a summary", len(records))
+	}
+	first := records[0]
+	if first["type"] != "entry" || first["source"] != files[0] || first["destination"] != filepath.Join(tmpDir, "1.txt") ||
+		first["key"] != "1" || first["index"] != 0.0 || first["status"] != statusPlanned {
+		t.Errorf("first entry = %v", first)
+	}
+	summary := records[2]
+	if summary["type"] != "summary" || summary["dry_run"] != true || summary["total"] != 2.0 || summary["version"] != float64(outputVersion) {
+		t.Errorf("summary = %v", summary)
+	}
+
+	// real run as one document
+	applyErr := plan.Apply(context.Background())
+	if applyErr != nil {
+		t.Fatal(applyErr)
+	}
+	buf.Reset()
+	if err := writeOutput(&buf, "json", plan, false, false, applyErr); err != nil {
+		t.Fatalf("writeOutput() error = %v", err)
+	}
+	var doc outputDocument
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON document: %v", err)
+	}
+	if want := map[string]int{statusRenamed: 2}; !reflect.DeepEqual(doc.Summary.Statuses, want) {
+		t.Errorf("statuses = %v, want %v", doc.Summary.Statuses, want)
+	}
+	if doc.Summary.Conflicts == nil || doc.Summary.Warnings == nil {
+		t.Error("conflicts and warnings must be empty arrays, not null")
+	}
+}
+
+func TestEntryStatus(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := []string{filepath.Join(tmpDir, "b.txt"), filepath.Join(tmpDir, "a.txt"), filepath.Join(tmpDir, "1.txt")}
+	for i, f := range files {
+		if err := os.WriteFile(f, make([]byte, i+1), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// b.txt -> 1.txt (a later source), a.txt -> 2.txt, 1.txt -> 3.txt
+	plan, err := renby.BuildPlan(files, renby.Options{Pattern: "0", FileMode: renby.SortBySize, Init: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rollback := &renby.RollbackError{Err: errors.New("disk full"), Steps: 1}
+	partial := &renby.RollbackError{Err: errors.New("disk full"), Steps: 1, Rollback: []error{errors.New("busy")}}
+	tests := []struct {
+		name     string
+		force    bool
+		dryRun   bool
+		applyErr error
+		want     []string
+	}{
+		{name: "blocked by conflict", dryRun: true, want: []string{statusConflict, statusSkipped, statusSkipped}},
+		{name: "forced dry run", force: true, dryRun: true, want: []string{statusPlanned, statusPlanned, statusPlanned}},
+		{name: "forced", force: true, want: []string{statusRenamed, statusRenamed, statusRenamed}},
+		{name: "rolled back", force: true, applyErr: rollback, want: []string{statusRolledBack, statusRolledBack, statusRolledBack}},
+		{name: "rollback failed", force: true, applyErr: partial, want: []string{statusFailed, statusFailed, statusFailed}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, e := range plan.Entries {
+				if got := entryStatus(e, plan, tt.force, tt.dryRun, tt.applyErr); got != tt.want[i] {
+					t.Errorf("entry %d status = %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
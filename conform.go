@@ -0,0 +1,244 @@
+package renby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// nameMatcher recognises file names produced by the naming template
+type nameMatcher struct {
+	re        *regexp.Regexp
+	slots     []counterSlot // one per capture group
+	autoWidth bool
+}
+
+// counterSlot describes how to read back one counter of the template
+type counterSlot struct {
+	formatter CounterFormatter
+	parser    CounterParser
+	width     int
+}
+
+// matcher returns a nameMatcher for names in dir
+func (t *template) matcher(dir string, opts Options) (*nameMatcher, error) {
+	m := &nameMatcher{autoWidth: opts.AutoWidth}
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, seg := range t.segments {
+		switch seg.kind {
+		case segLiteral:
+			expr.WriteString(regexp.QuoteMeta(seg.text))
+		case segCounter:
+			slot := counterSlot{formatter: seg.style, parser: seg.style, width: seg.width}
+			pattern := seg.style.pattern()
+			if opts.Counter != nil {
+				parser, ok := opts.Counter.(CounterParser)
+				if !ok {
+					return nil, fmt.Errorf("counter formatter %T cannot parse existing names", opts.Counter)
+				}
+				slot.formatter, slot.parser = opts.Counter, parser
+				if style, ok := opts.Counter.(CounterStyle); ok {
+					pattern = style.pattern()
+				} else {
+					pattern = ".+?"
+				}
+			}
+			m.slots = append(m.slots, slot)
+			expr.WriteString("(" + pattern + ")")
+		case segName, segTime:
+			expr.WriteString(".*?")
+		case segExt:
+			expr.WriteString(`(?:\.[^.]*)?`)
+		case segDir:
+			// {dir} is the directory of the source, not the output directory
+			if opts.OutDir != "" {
+				expr.WriteString(".*?")
+			} else {
+				expr.WriteString(regexp.QuoteMeta(filepath.Base(dir)))
+			}
+		case segSize:
+			expr.WriteString("[0-9]+")
+		}
+	}
+	expr.WriteString("$")
+
+	if len(m.slots) == 0 {
+		return nil, fmt.Errorf("template has no counter to continue")
+	}
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+	m.re = re
+	return m, nil
+}
+
+// counter returns the counter of name when it conforms to the template.
+// Every counter of the name must be written exactly as the template would.
+func (m *nameMatcher) counter(name string) (int, bool) {
+	groups := m.re.FindStringSubmatch(name)
+	if groups == nil {
+		return 0, false
+	}
+
+	counter := -1
+	for i, slot := range m.slots {
+		text := groups[i+1]
+		n, err := slot.parser.ParseCounter(text)
+		if err != nil || (counter >= 0 && n != counter) {
+			return 0, false
+		}
+		width := slot.width
+		if m.autoWidth {
+			width = len(text)
+		}
+		if canonical, err := slot.formatter.FormatCounter(n, width); err != nil || canonical != text {
+			return 0, false
+		}
+		counter = n
+	}
+	return counter, true
+}
+
+// scanConforming reads the destination directories of files and returns the
+// names which already conform to the template and belong to group with their
+// counters, and the highest counter found, -1 when none conforms.
+// inBatch holds the paths of the files and of their sidecars.
+func scanConforming(files []FileInfo, inBatch map[string]struct{}, group string, opts Options) (map[string]int, int, error) {
+	conforming := make(map[string]int)
+	highest := -1
+	scanned := make(map[string]struct{})
+	for _, fi := range files {
+		dir := opts.destDir(fi.Path)
+		if _, ok := scanned[dir]; ok {
+			continue
+		}
+		scanned[dir] = struct{}{}
+
+		m, err := opts.tmpl.matcher(dir, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) && dir == opts.OutDir {
+			continue // created when the plan is applied
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			n, ok := m.counter(entry.Name())
+			if !ok {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if _, ok := inBatch[path]; !ok && opts.Group != nil {
+				if inGroup, err := belongsTo(path, group, opts); err != nil {
+					return nil, 0, err
+				} else if !inGroup {
+					continue
+				}
+			}
+			conforming[path] = n
+			highest = max(highest, n)
+		}
+	}
+	return conforming, highest, nil
+}
+
+// belongsTo reports whether the file at path outside the batch belongs to group
+func belongsTo(path, group string, opts Options) (bool, error) {
+	infos, err := collectFileInfo([]string{path}, opts)
+	if err != nil {
+		return false, err
+	}
+	return len(infos) == 1 && opts.Group(infos[0]) == group, nil
+}
+
+// numberFiles returns the sorted files of a group in the order they are
+// numbered along with their counters, -1 for a file which keeps its
+// conforming name. sidecars holds the sidecars of the files by primary path.
+func numberFiles(files []FileInfo, sidecars map[string][]FileInfo, group string, opts Options) ([]FileInfo, []int, error) {
+	if !opts.keepsConforming() {
+		counters, err := opts.counters(opts.Init, len(files))
+		return files, counters, err
+	}
+
+	inBatch := make(map[string]struct{}, len(files))
+	for _, fi := range files {
+		inBatch[fi.Path] = struct{}{}
+		for _, sc := range sidecars[fi.Path] {
+			inBatch[sc.Path] = struct{}{}
+		}
+	}
+	conforming, highest, err := scanConforming(files, inBatch, group, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// counters of conforming names outside the batch are never reused
+	reserved := make(map[int]struct{})
+	for path, n := range conforming {
+		if _, ok := inBatch[path]; !ok {
+			reserved[n] = struct{}{}
+		}
+	}
+
+	step := opts.step()
+	counter := opts.Init
+	next := func() int {
+		for {
+			c := counter
+			counter += step
+			if _, ok := reserved[c]; !ok {
+				return c
+			}
+		}
+	}
+
+	if opts.CloseGaps {
+		// renumbering in ascending order only moves files to vacated counters
+		var kept, newcomers []FileInfo
+		for _, fi := range files {
+			if _, ok := conforming[fi.Path]; ok {
+				kept = append(kept, fi)
+			} else {
+				newcomers = append(newcomers, fi)
+			}
+		}
+		sort.SliceStable(kept, func(i, j int) bool {
+			return conforming[kept[i].Path] < conforming[kept[j].Path]
+		})
+		ordered := append(kept, newcomers...)
+		counters := make([]int, len(ordered))
+		for i := range ordered {
+			counters[i] = next()
+		}
+		return ordered, counters, nil
+	}
+
+	for _, fi := range files {
+		if n, ok := conforming[fi.Path]; ok {
+			reserved[n] = struct{}{}
+		}
+	}
+	if opts.Append && highest >= 0 {
+		counter = max(counter, highest+step)
+	}
+	counters := make([]int, len(files))
+	for i, fi := range files {
+		if _, ok := conforming[fi.Path]; ok {
+			counters[i] = -1
+		} else {
+			counters[i] = next()
+		}
+	}
+	return files, counters, nil
+}
@@ -0,0 +1,216 @@
+package renby
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNameMatcher(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		file  string
+		want  int
+		match bool
+	}{
+		{name: "padded decimal", opts: Options{Pattern: "000000"}, file: "000341.png", want: 341, match: true},
+		{name: "wider than pattern", opts: Options{Pattern: "00"}, file: "123.png", want: 123, match: true},
+		{name: "too narrow", opts: Options{Pattern: "0000"}, file: "341.png", match: false},
+		{name: "extra padding", opts: Options{Pattern: "00"}, file: "0123.png", match: false},
+		{name: "auto width", opts: Options{Pattern: "0", AutoWidth: true}, file: "0042.png", want: 42, match: true},
+		{name: "prefix and postfix", opts: Options{Pre: "img", Post: "_x", Pattern: "000"}, file: "img007_x.jpg", want: 7, match: true},
+		{name: "missing prefix", opts: Options{Pre: "img", Pattern: "000"}, file: "007.jpg", match: false},
+		{name: "no extension", opts: Options{Pattern: "000"}, file: "007", want: 7, match: true},
+		{name: "double extension", opts: Options{Pattern: "000"}, file: "007.tar.gz", match: false},
+		{name: "hex case", opts: Options{Pattern: "xx"}, file: "0A.txt", match: false},
+		{name: "upper roman", opts: Options{Pattern: "I"}, file: "XIV.md", want: 14, match: true},
+		{name: "non canonical roman", opts: Options{Pattern: "I"}, file: "IIII.md", match: false},
+		{name: "alphabetic", opts: Options{Pattern: "a"}, file: "ab.txt", want: 28, match: true},
+		{name: "template with name", opts: Options{Template: "{n:03}_{name}{ext}"}, file: "012_beach.jpg", want: 12, match: true},
+		{name: "template with dir", opts: Options{Template: "{dir}-{n}{ext}"}, file: "trip-3.jpg", want: 3, match: true},
+		{name: "template with other dir", opts: Options{Template: "{dir}-{n}{ext}"}, file: "home-3.jpg", match: false},
+		{name: "formatter override", opts: Options{Pattern: "000", Counter: CounterHexUpper}, file: "0FF.txt", want: 255, match: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			m, err := tt.opts.tmpl.matcher("/photos/trip", tt.opts)
+			if err != nil {
+				t.Fatalf("matcher() error = %v", err)
+			}
+			got, ok := m.counter(tt.file)
+			if ok != tt.match || (ok && got != tt.want) {
+				t.Errorf("counter(%q) = %d, %v, want %d, %v", tt.file, got, ok, tt.want, tt.match)
+			}
+		})
+	}
+}
+
+func TestNameMatcher_Errors(t *testing.T) {
+	tests := []Options{
+		{Template: "{name}{ext}"},
+		{Pattern: "000", Counter: formatterFunc(func(n, width int) (string, error) { return "", nil })},
+	}
+
+	for _, opts := range tests {
+		if err := opts.Validate(); err != nil {
+			t.Fatalf("Validate() error = %v", err)
+		}
+		if _, err := opts.tmpl.matcher("/d", opts); err == nil {
+			t.Errorf("matcher() error = nil for %+v, want error", opts)
+		}
+	}
+}
+
+// formatterFunc is a CounterFormatter which cannot parse counters
+type formatterFunc func(n, width int) (string, error)
+
+func (f formatterFunc) FormatCounter(n, width int) (string, error) { return f(n, width) }
+
+func TestBuildPlan_Append(t *testing.T) {
+	dir := t.TempDir()
+	writeSizedFiles(t, dir, map[string]int{"000010.png": 1})
+	files := writeSizedFiles(t, dir, map[string]int{
+		"000001.png": 10,
+		"000002.png": 20,
+		"scan_b.png": 40,
+		"scan_a.png": 30,
+	})
+
+	plan, err := BuildPlan(files, Options{Pattern: "000000", FileMode: SortBySize, Init: 1, Append: true})
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+
+	want := map[string]string{
+		"000001.png": "000001.png",
+		"000002.png": "000002.png",
+		"scan_a.png": "000011.png",
+		"scan_b.png": "000012.png",
+	}
+	for _, e := range plan.Entries {
+		src := filepath.Base(e.Source)
+		if got := filepath.Base(e.Destination); got != want[src] {
+			t.Errorf("%s -> %s, want %s", src, got, want[src])
+		}
+	}
+	if plan.HasConflicts() {
+		t.Errorf("unexpected conflicts: %v", plan.Conflicts)
+	}
+}
+
+func TestBuildPlan_AppendEmptyDirectory(t *testing.T) {
+	dir := t.TempDir()
+	files := writeSizedFiles(t, dir, map[string]int{"a.png": 1, "b.png": 2})
+
+	plan, err := BuildPlan(files, Options{Pattern: "00", FileMode: SortBySize, Init: 5, Step: 5, Append: true})
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+	for i, want := range []string{"05.png", "10.png"} {
+		if got := filepath.Base(plan.Entries[i].Destination); got != want {
+			t.Errorf("entry %d destination = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestBuildPlan_SkipConforming(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		outside map[string]int // conforming files not passed to BuildPlan
+		want    map[string]string
+	}{
+		{
+			name: "newcomers fill free counters",
+			opts: Options{Pattern: "000", FileMode: SortBySize, Init: 1, SkipConforming: true},
+			want: map[string]string{"001.jpg": "001.jpg", "003.jpg": "003.jpg", "x.jpg": "002.jpg", "y.jpg": "004.jpg"},
+		},
+		{
+			name:    "counters outside the batch are reserved",
+			opts:    Options{Pattern: "000", FileMode: SortBySize, Init: 1, SkipConforming: true},
+			outside: map[string]int{"002.jpg": 1},
+			want:    map[string]string{"001.jpg": "001.jpg", "003.jpg": "003.jpg", "x.jpg": "004.jpg", "y.jpg": "005.jpg"},
+		},
+		{
+			name: "close gaps",
+			opts: Options{Pattern: "000", FileMode: SortBySize, Init: 1, CloseGaps: true},
+			want: map[string]string{"001.jpg": "001.jpg", "003.jpg": "002.jpg", "x.jpg": "003.jpg", "y.jpg": "004.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeSizedFiles(t, dir, tt.outside)
+			// conforming files are the largest so that size order differs from counter order
+			files := writeSizedFiles(t, dir, map[string]int{"003.jpg": 40, "001.jpg": 30, "x.jpg": 10, "y.jpg": 20})
+
+			plan, err := BuildPlan(files, tt.opts)
+			if err != nil {
+				t.Fatalf("BuildPlan() error = %v", err)
+			}
+			if plan.HasConflicts() {
+				t.Fatalf("unexpected conflicts: %v", plan.Conflicts)
+			}
+			for _, e := range plan.Entries {
+				src := filepath.Base(e.Source)
+				if got := filepath.Base(e.Destination); got != tt.want[src] {
+					t.Errorf("%s -> %s, want %s", src, got, tt.want[src])
+				}
+			}
+			if err := plan.Apply(context.Background()); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			// a rerun over the renamed files changes nothing
+			var renamed []string
+			for _, name := range tt.want {
+				renamed = append(renamed, filepath.Join(dir, name))
+			}
+			again, err := BuildPlan(renamed, tt.opts)
+			if err != nil {
+				t.Fatalf("BuildPlan() rerun error = %v", err)
+			}
+			for _, e := range again.Entries {
+				if !e.Unchanged() {
+					t.Errorf("rerun renames %s -> %s", filepath.Base(e.Source), filepath.Base(e.Destination))
+				}
+			}
+		})
+	}
+}
+
+func TestBuildPlan_SkipConformingOutDir(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(t.TempDir(), "out")
+	files := writeSizedFiles(t, src, map[string]int{"a.jpg": 1})
+	opts := Options{Template: "{dir}_{n:03}{ext}", FileMode: SortBySize, Init: 1, SkipConforming: true, OutDir: outDir, Mode: ModeCopy}
+	if err := RenameFiles(files, opts); err != nil {
+		t.Fatalf("RenameFiles() error = %v", err)
+	}
+
+	// the second run keeps numbering after the output of the first one
+	files = append(files, writeSizedFiles(t, src, map[string]int{"b.jpg": 2})...)
+	plan, err := BuildPlan(files, opts)
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+	if plan.HasConflicts() {
+		t.Fatalf("unexpected conflicts: %v", plan.Conflicts)
+	}
+	want := map[string]string{"a.jpg": "src_002.jpg", "b.jpg": "src_003.jpg"}
+	for _, e := range plan.Entries {
+		if got := filepath.Base(e.Destination); got != want[filepath.Base(e.Source)] {
+			t.Errorf("%s -> %s, want %s", filepath.Base(e.Source), got, want[filepath.Base(e.Source)])
+		}
+	}
+}
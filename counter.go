@@ -0,0 +1,262 @@
+package renby
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CounterFormatter formats the counter of a renamed file.
+// Width is the requested minimum width, zero meaning no padding.
+type CounterFormatter interface {
+	FormatCounter(n, width int) (string, error)
+}
+
+// CounterParser reads back a counter written by a CounterFormatter.
+// It is required to recognise existing names, e.g. by Options.Append.
+type CounterParser interface {
+	ParseCounter(s string) (int, error)
+}
+
+// CounterStyle is a built-in CounterFormatter and CounterParser
+type CounterStyle int
+
+const (
+	CounterDecimal     CounterStyle = iota // 0, 1, ..., 9, 10
+	CounterHex                             // 0, 1, ..., f, 10
+	CounterHexUpper                        // 0, 1, ..., F, 10
+	CounterAlpha                           // a, b, ..., z, aa (starts at 1)
+	CounterAlphaUpper                      // A, B, ..., Z, AA (starts at 1)
+	CounterBase36                          // 0, 1, ..., z, 10
+	CounterBase36Upper                     // 0, 1, ..., Z, 10
+	CounterRoman                           // i, ii, iii, iv (1 to 3999)
+	CounterRomanUpper                      // I, II, III, IV (1 to 3999)
+)
+
+// counterStyles lists the style names and the pattern character selecting each style
+var counterStyles = []struct {
+	style CounterStyle
+	name  string
+	char  byte
+}{
+	{CounterDecimal, "decimal", '0'},
+	{CounterHex, "hex", 'x'},
+	{CounterHexUpper, "upper-hex", 'X'},
+	{CounterAlpha, "lower-alpha", 'a'},
+	{CounterAlphaUpper, "upper-alpha", 'A'},
+	{CounterBase36, "base36", 'z'},
+	{CounterBase36Upper, "upper-base36", 'Z'},
+	{CounterRoman, "lower-roman", 'i'},
+	{CounterRomanUpper, "upper-roman", 'I'},
+}
+
+// ParseCounterStyle returns the counter style for a name such as "upper-roman"
+func ParseCounterStyle(name string) (CounterStyle, error) {
+	for _, cs := range counterStyles {
+		if cs.name == name {
+			return cs.style, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown counter style '%s'", name)
+}
+
+// String returns the name of the style
+func (s CounterStyle) String() string {
+	for _, cs := range counterStyles {
+		if cs.style == s {
+			return cs.name
+		}
+	}
+	return fmt.Sprintf("CounterStyle(%d)", int(s))
+}
+
+// counterStyleOf returns the style selected by a pattern character
+func counterStyleOf(c byte) (CounterStyle, bool) {
+	for _, cs := range counterStyles {
+		if cs.char == c && c != '0' {
+			return cs.style, true
+		}
+	}
+	return CounterDecimal, false
+}
+
+// patternStyle returns the style selected by the first style character of
+// a pattern such as "xxxx" or "AAA", decimal when there is none
+func patternStyle(pattern string) CounterStyle {
+	for i := 0; i < len(pattern); i++ {
+		if style, ok := counterStyleOf(pattern[i]); ok {
+			return style
+		}
+	}
+	return CounterDecimal
+}
+
+// FormatCounter formats n in the style. Width pads decimal, hexadecimal
+// and base36 counters with zeros; alphabetic and roman counters are not padded.
+func (s CounterStyle) FormatCounter(n, width int) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("counter %d is negative", n)
+	}
+
+	switch s {
+	case CounterDecimal:
+		return padZero(strconv.Itoa(n), width), nil
+	case CounterHex:
+		return padZero(strconv.FormatInt(int64(n), 16), width), nil
+	case CounterHexUpper:
+		return padZero(strings.ToUpper(strconv.FormatInt(int64(n), 16)), width), nil
+	case CounterBase36:
+		return padZero(strconv.FormatInt(int64(n), 36), width), nil
+	case CounterBase36Upper:
+		return padZero(strings.ToUpper(strconv.FormatInt(int64(n), 36)), width), nil
+	case CounterAlpha, CounterAlphaUpper:
+		if n < 1 {
+			return "", fmt.Errorf("alphabetic counter must start at 1, got %d", n)
+		}
+		a := alphabetic(n)
+		if s == CounterAlphaUpper {
+			a = strings.ToUpper(a)
+		}
+		return a, nil
+	case CounterRoman, CounterRomanUpper:
+		if n < 1 || n > 3999 {
+			return "", fmt.Errorf("roman counter must be between 1 and 3999, got %d", n)
+		}
+		r := roman(n)
+		if s == CounterRoman {
+			r = strings.ToLower(r)
+		}
+		return r, nil
+	default:
+		return "", fmt.Errorf("unknown counter style %d", int(s))
+	}
+}
+
+// ParseCounter parses a counter formatted in the style, ignoring zero padding
+func (s CounterStyle) ParseCounter(text string) (int, error) {
+	if text == "" {
+		return 0, fmt.Errorf("empty counter")
+	}
+
+	var n int64
+	var err error
+	switch s {
+	case CounterDecimal:
+		n, err = strconv.ParseInt(text, 10, 0)
+	case CounterHex, CounterHexUpper:
+		n, err = strconv.ParseInt(text, 16, 0)
+	case CounterBase36, CounterBase36Upper:
+		n, err = strconv.ParseInt(text, 36, 0)
+	case CounterAlpha, CounterAlphaUpper:
+		return parseAlphabetic(strings.ToLower(text))
+	case CounterRoman, CounterRomanUpper:
+		return parseRoman(strings.ToUpper(text))
+	default:
+		return 0, fmt.Errorf("unknown counter style %d", int(s))
+	}
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s counter %q", s, text)
+	}
+	return int(n), nil
+}
+
+// pattern returns a regular expression matching the counters of the style
+func (s CounterStyle) pattern() string {
+	switch s {
+	case CounterDecimal:
+		return "[0-9]+"
+	case CounterHex:
+		return "[0-9a-f]+"
+	case CounterHexUpper:
+		return "[0-9A-F]+"
+	case CounterAlpha:
+		return "[a-z]+"
+	case CounterAlphaUpper:
+		return "[A-Z]+"
+	case CounterBase36:
+		return "[0-9a-z]+"
+	case CounterBase36Upper:
+		return "[0-9A-Z]+"
+	case CounterRoman:
+		return "[ivxlcdm]+"
+	case CounterRomanUpper:
+		return "[IVXLCDM]+"
+	default:
+		return ".+?"
+	}
+}
+
+func padZero(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	return strings.Repeat("0", width-len(s)) + s
+}
+
+// alphabetic returns the bijective base-26 form of n: 1 -> a, 26 -> z, 27 -> aa
+func alphabetic(n int) string {
+	var buf []byte
+	for n > 0 {
+		n--
+		buf = append(buf, byte('a'+n%26))
+		n /= 26
+	}
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return string(buf)
+}
+
+// parseAlphabetic is the inverse of alphabetic
+func parseAlphabetic(s string) (int, error) {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'a' || s[i] > 'z' || n > (1<<31)/26 {
+			return 0, fmt.Errorf("invalid alphabetic counter %q", s)
+		}
+		n = n*26 + int(s[i]-'a') + 1
+	}
+	return n, nil
+}
+
+// parseRoman is the inverse of roman, accepting canonical numerals only
+func parseRoman(s string) (int, error) {
+	values := map[byte]int{'I': 1, 'V': 5, 'X': 10, 'L': 50, 'C': 100, 'D': 500, 'M': 1000}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		v, ok := values[s[i]]
+		if !ok {
+			return 0, fmt.Errorf("invalid roman counter %q", s)
+		}
+		if i+1 < len(s) && values[s[i+1]] > v {
+			n -= v
+		} else {
+			n += v
+		}
+	}
+	if n < 1 || n > 3999 || roman(n) != s {
+		return 0, fmt.Errorf("invalid roman counter %q", s)
+	}
+	return n, nil
+}
+
+// roman returns the uppercase roman numeral of n (1 to 3999)
+func roman(n int) string {
+	numerals := []struct {
+		value  int
+		symbol string
+	}{
+		{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"},
+		{100, "C"}, {90, "XC"}, {50, "L"}, {40, "XL"},
+		{10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+	}
+
+	var b strings.Builder
+	for _, num := range numerals {
+		for n >= num.value {
+			b.WriteString(num.symbol)
+			n -= num.value
+		}
+	}
+	return b.String()
+}
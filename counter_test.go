@@ -0,0 +1,245 @@
+package renby
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCounterStyle_FormatCounter(t *testing.T) {
+	tests := []struct {
+		style CounterStyle
+		n     int
+		width int
+		want  string
+	}{
+		{CounterDecimal, 42, 4, "0042"},
+		{CounterDecimal, 12345, 3, "12345"},
+		{CounterHex, 255, 4, "00ff"},
+		{CounterHexUpper, 255, 4, "00FF"},
+		{CounterAlpha, 1, 0, "a"},
+		{CounterAlpha, 26, 0, "z"},
+		{CounterAlpha, 27, 0, "aa"},
+		{CounterAlpha, 702, 3, "zz"},
+		{CounterAlphaUpper, 703, 0, "AAA"},
+		{CounterBase36, 35, 2, "0z"},
+		{CounterBase36Upper, 36*36 + 35, 0, "10Z"},
+		{CounterRoman, 4, 0, "iv"},
+		{CounterRomanUpper, 1994, 0, "MCMXCIV"},
+		{CounterRomanUpper, 3999, 0, "MMMCMXCIX"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.style.String()+"/"+tt.want, func(t *testing.T) {
+			got, err := tt.style.FormatCounter(tt.n, tt.width)
+			if err != nil {
+				t.Fatalf("FormatCounter() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FormatCounter(%d, %d) = %q, want %q", tt.n, tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCounterStyle_FormatCounterErrors(t *testing.T) {
+	tests := []struct {
+		style CounterStyle
+		n     int
+	}{
+		{CounterDecimal, -1},
+		{CounterAlpha, 0},
+		{CounterRoman, 0},
+		{CounterRomanUpper, 4000},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.style.FormatCounter(tt.n, 0); err == nil {
+			t.Errorf("%v.FormatCounter(%d) error = nil, want error", tt.style, tt.n)
+		}
+	}
+}
+
+func TestParseCounterStyle(t *testing.T) {
+	for _, cs := range counterStyles {
+		got, err := ParseCounterStyle(cs.name)
+		if err != nil || got != cs.style {
+			t.Errorf("ParseCounterStyle(%q) = %v, %v, want %v", cs.name, got, err, cs.style)
+		}
+	}
+	if _, err := ParseCounterStyle("klingon"); err == nil {
+		t.Error("ParseCounterStyle() error = nil, want error")
+	}
+}
+
+func TestPatternStyle(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    CounterStyle
+	}{
+		{"000", CounterDecimal},
+		{"xxx", CounterHex},
+		{"0x0", CounterHex},
+		{"XXXX", CounterHexUpper},
+		{"a", CounterAlpha},
+		{"AA", CounterAlphaUpper},
+		{"zzz", CounterBase36},
+		{"I", CounterRomanUpper},
+	}
+
+	for _, tt := range tests {
+		if got := patternStyle(tt.pattern); got != tt.want {
+			t.Errorf("patternStyle(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestBuildPlan_CounterStyles(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "pattern character",
+			opts: Options{Pattern: "A", FileMode: SortBySize, Init: 26},
+			want: []string{"Z.txt", "AA.txt"},
+		},
+		{
+			name: "formatter overrides pattern",
+			opts: Options{Pattern: "xxx", FileMode: SortBySize, Init: 1, Counter: CounterRoman},
+			want: []string{"i.txt", "ii.txt"},
+		},
+		{
+			name: "roman out of range",
+			opts: Options{Pattern: "I", FileMode: SortBySize, Init: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := writeSizedFiles(t, dir, map[string]int{"a.txt": 1, "b.txt": 2})
+
+			plan, err := BuildPlan(files, tt.opts)
+			if tt.want == nil {
+				if err == nil || !strings.Contains(err.Error(), "roman counter") {
+					t.Fatalf("BuildPlan() error = %v, want roman counter error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildPlan() error = %v", err)
+			}
+			for i, e := range plan.Entries {
+				if got := filepath.Base(e.Destination); got != tt.want[i] {
+					t.Errorf("entry %d destination = %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBuildPlan_Numbering(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "step",
+			opts: Options{Pattern: "000", FileMode: SortBySize, Init: 10, Step: 10},
+			want: []string{"010.txt", "020.txt", "030.txt"},
+		},
+		{
+			name: "descending",
+			opts: Options{Pattern: "0", FileMode: SortBySize, Init: 5, Descending: true},
+			want: []string{"5.txt", "4.txt", "3.txt"},
+		},
+		{
+			name: "descending step reaches zero",
+			opts: Options{Pattern: "00", FileMode: SortBySize, Init: 10, Step: 5, Descending: true},
+			want: []string{"10.txt", "05.txt", "00.txt"},
+		},
+		{
+			name: "auto width replaces pattern width",
+			opts: Options{Pattern: "000000", FileMode: SortBySize, Init: 98, AutoWidth: true},
+			want: []string{"098.txt", "099.txt", "100.txt"},
+		},
+		{
+			name: "auto width in template",
+			opts: Options{Template: "{n:x}{ext}", FileMode: SortBySize, Init: 1, Step: 100, AutoWidth: true},
+			want: []string{"01.txt", "65.txt", "c9.txt"},
+		},
+		{
+			name:    "descending below zero",
+			opts:    Options{Pattern: "0", FileMode: SortBySize, Init: 1, Descending: true},
+			wantErr: "goes below zero",
+		},
+		{
+			name:    "append and descending",
+			opts:    Options{Pattern: "0", FileMode: SortBySize, Init: 9, Descending: true, Append: true},
+			wantErr: "cannot be combined with descending",
+		},
+		{
+			name:    "negative step",
+			opts:    Options{Pattern: "0", FileMode: SortBySize, Init: 1, Step: -1},
+			wantErr: "step must be positive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := writeSizedFiles(t, dir, map[string]int{"a.txt": 1, "b.txt": 2, "c.txt": 3})
+
+			plan, err := BuildPlan(files, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("BuildPlan() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildPlan() error = %v", err)
+			}
+			for i, e := range plan.Entries {
+				if got := filepath.Base(e.Destination); got != tt.want[i] {
+					t.Errorf("entry %d destination = %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCounterStyle_ParseCounter(t *testing.T) {
+	for _, cs := range counterStyles {
+		for _, n := range []int{1, 9, 26, 27, 255, 1994, 3999} {
+			text, err := cs.style.FormatCounter(n, 0)
+			if err != nil {
+				t.Fatalf("%v.FormatCounter(%d) error = %v", cs.style, n, err)
+			}
+			if got, err := cs.style.ParseCounter(text); err != nil || got != n {
+				t.Errorf("%v.ParseCounter(%q) = %d, %v, want %d", cs.style, text, got, err, n)
+			}
+		}
+	}
+
+	invalid := []struct {
+		style CounterStyle
+		text  string
+	}{
+		{CounterDecimal, ""},
+		{CounterDecimal, "-1"},
+		{CounterHex, "g"},
+		{CounterAlpha, "a1"},
+		{CounterRomanUpper, "IIII"},
+		{CounterRomanUpper, "VX"},
+	}
+	for _, tt := range invalid {
+		if _, err := tt.style.ParseCounter(tt.text); err == nil {
+			t.Errorf("%v.ParseCounter(%q) error = nil, want error", tt.style, tt.text)
+		}
+	}
+}
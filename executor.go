@@ -0,0 +1,152 @@
+package renby
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RollbackError is returned when a batch failed after some steps were taken.
+// The completed steps have been reversed; Rollback lists the steps which
+// could not be reversed, leaving the batch partially applied. Cleanup lists
+// failures to update the journal or the intent log, which do not affect
+// the files.
+type RollbackError struct {
+	Err      error   // error which aborted the batch
+	Steps    int     // number of steps which were reversed or attempted
+	Rollback []error // failures while reversing
+	Cleanup  []error // failures while recording the reversal
+}
+
+func (e *RollbackError) Error() string {
+	var msg string
+	if len(e.Rollback) == 0 {
+		msg = fmt.Sprintf("%v (rolled back %d step(s))", e.Err, e.Steps)
+	} else {
+		msg = fmt.Sprintf("%v; rollback failed: %s", e.Err, joinErrors(e.Rollback))
+	}
+	if len(e.Cleanup) > 0 {
+		msg += fmt.Sprintf("; journal cleanup failed: %s", joinErrors(e.Cleanup))
+	}
+	return msg
+}
+
+// joinErrors joins the messages of errs with "; "
+func joinErrors(errs []error) string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// step represents a completed rename, or a file created from a source
+type step struct {
+	from    string
+	to      string
+	backup  bool // existing destination moved aside, not journaled
+	created bool // to was created from from, which is left in place
+}
+
+// executor performs file operations and records every completed step
+// so that the batch can be rolled back on failure.
+type executor struct {
+	mode    Mode
+	journal *journalWriter
+	intent  *intentLog
+	steps   []step
+}
+
+// rename moves from -> to, across filesystems if needed, and records the step in the journal
+func (x *executor) rename(from, to string) error {
+	if err := moveFile(from, to); err != nil {
+		return err
+	}
+	x.steps = append(x.steps, step{from: from, to: to})
+	return x.journal.record(opRename, from, to)
+}
+
+// transfer brings the source from to to according to the mode of the
+// batch and records the step in the journal
+func (x *executor) transfer(from, to string) error {
+	if x.mode == ModeMove {
+		return x.rename(from, to)
+	}
+	if err := createFrom(x.mode, from, to); err != nil {
+		return err
+	}
+	x.steps = append(x.steps, step{from: from, to: to, created: true})
+	return x.journal.record(x.mode.String(), from, to)
+}
+
+// moveAside moves an existing destination to backup until the batch commits
+func (x *executor) moveAside(path, backup string) error {
+	if err := os.Rename(path, backup); err != nil {
+		return err
+	}
+	x.steps = append(x.steps, step{from: path, to: backup, backup: true})
+	return nil
+}
+
+// commit removes the destinations overwritten by the batch
+func (x *executor) commit() error {
+	for _, s := range x.steps {
+		if !s.backup {
+			continue
+		}
+		if err := os.Remove(s.to); err != nil {
+			return fmt.Errorf("failed to remove overwritten destination %q: %w", s.to, err)
+		}
+	}
+	return x.intent.remove()
+}
+
+// rollback reverses the completed steps in reverse order.
+// The journal records the reversal, and together with the intent log is
+// discarded once nothing remains to undo. After a partial rollback the
+// intent log is kept so that Recover can finish the job.
+func (x *executor) rollback(cause error) error {
+	if len(x.steps) == 0 {
+		if err := errors.Join(x.journal.discard(), x.intent.remove()); err != nil {
+			return errors.Join(cause, err)
+		}
+		return cause
+	}
+
+	var errs, cleanup []error
+	for i := len(x.steps) - 1; i >= 0; i-- {
+		s := x.steps[i]
+		if s.created {
+			if err := os.Remove(s.to); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove %q: %w", s.to, err))
+			} else if err := x.journal.recordRemoval(s.to); err != nil {
+				cleanup = append(cleanup, err)
+			}
+			continue
+		}
+		if err := moveFile(s.to, s.from); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %q to %q: %w", s.to, s.from, err))
+			continue
+		}
+		if !s.backup {
+			if err := x.journal.record(opRename, s.to, s.from); err != nil {
+				cleanup = append(cleanup, err)
+			}
+		}
+	}
+	if len(errs) == 0 {
+		if err := x.journal.discard(); err != nil {
+			cleanup = append(cleanup, err)
+		}
+		if err := x.intent.remove(); err != nil {
+			cleanup = append(cleanup, err)
+		}
+	}
+
+	return &RollbackError{Err: cause, Steps: len(x.steps), Rollback: errs, Cleanup: cleanup}
+}
@@ -0,0 +1,115 @@
+package renby
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestApply_Rollback(t *testing.T) {
+	tests := []struct {
+		name  string
+		force bool
+		// breaks the batch after the plan has been built
+		sabotage func(t *testing.T, dir string)
+	}{
+		{
+			name:  "destination appears before direct rename",
+			force: false,
+			sabotage: func(t *testing.T, dir string) {
+				if err := os.WriteFile(filepath.Join(dir, "3.txt"), []byte("x"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:  "source disappears before two-phase rename",
+			force: true,
+			sabotage: func(t *testing.T, dir string) {
+				if err := os.Remove(filepath.Join(dir, "c.txt")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			journalDir := t.TempDir()
+			files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20, "c.txt": 30, "d.txt": 40})
+
+			opts := Options{Pattern: "0", FileMode: SortBySize, Init: 1, ForceOverwrite: tt.force, JournalDir: journalDir}
+			plan, err := BuildPlan(files, opts)
+			if err != nil {
+				t.Fatalf("BuildPlan() error = %v", err)
+			}
+			tt.sabotage(t, dir)
+			before := listNames(t, dir)
+
+			err = plan.Apply(context.Background())
+			var rbErr *RollbackError
+			if !errors.As(err, &rbErr) {
+				t.Fatalf("Apply() error = %v, want *RollbackError", err)
+			}
+			if len(rbErr.Rollback) != 0 {
+				t.Errorf("unexpected rollback failures: %v", rbErr.Rollback)
+			}
+			if got := listNames(t, dir); !slices.Equal(got, before) {
+				t.Errorf("names after rollback = %v, want %v", got, before)
+			}
+			if _, err := LatestJournal(journalDir); !errors.Is(err, ErrNoJournal) {
+				t.Errorf("journal of a rolled back batch should be discarded, got %v", err)
+			}
+		})
+	}
+}
+
+func TestApply_ForceOverwriteCommits(t *testing.T) {
+	dir := t.TempDir()
+	files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10})
+	if err := os.WriteFile(filepath.Join(dir, "1.txt"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{Pattern: "0", FileMode: SortBySize, Init: 1, ForceOverwrite: true}
+	if err := RenameFiles(files, opts); err != nil {
+		t.Fatalf("RenameFiles() error = %v", err)
+	}
+	if got, want := listNames(t, dir), []string{"1.txt"}; !slices.Equal(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "1.txt")); err != nil || info.Size() != 10 {
+		t.Errorf("1.txt should be the renamed source: %v, %v", info, err)
+	}
+}
+
+func TestRollback_JournalFailure(t *testing.T) {
+	dir := t.TempDir()
+	from, to := filepath.Join(dir, "a.txt"), filepath.Join(dir, "1.txt")
+	if err := os.WriteFile(to, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a closed journal file fails every write
+	file, err := os.Create(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	exec := &executor{journal: &journalWriter{file: file}, steps: []step{{from: from, to: to}}}
+	err = exec.rollback(errors.New("boom"))
+	var rbErr *RollbackError
+	if !errors.As(err, &rbErr) {
+		t.Fatalf("rollback() error = %v, want *RollbackError", err)
+	}
+	if len(rbErr.Rollback) != 0 || len(rbErr.Cleanup) == 0 {
+		t.Errorf("rollback() Rollback = %v, Cleanup = %v, want only cleanup failures", rbErr.Rollback, rbErr.Cleanup)
+	}
+	if !exists(from) {
+		t.Errorf("%s was not restored", from)
+	}
+}
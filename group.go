@@ -0,0 +1,62 @@
+package renby
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// GroupFunc returns the group of a file. Every group is numbered with its
+// own sequence starting at Options.Init, in the order of the sorted files.
+type GroupFunc func(fi FileInfo) string
+
+// GroupByDir groups files by their parent directory
+func GroupByDir(fi FileInfo) string {
+	return filepath.Dir(fi.Path)
+}
+
+// GroupByExt groups files by their extension, ignoring case
+func GroupByExt(fi FileInfo) string {
+	return strings.ToLower(filepath.Ext(fi.Path))
+}
+
+// GroupByTime groups files by a timestamp formatted with layout,
+// e.g. "2006-01-02" for one group per calendar day
+func GroupByTime(mode SortMode, layout string) GroupFunc {
+	return func(fi FileInfo) string {
+		return fileTime(fi, mode).Format(layout)
+	}
+}
+
+// GroupByDay groups files by the calendar day of a timestamp
+func GroupByDay(mode SortMode) GroupFunc {
+	return GroupByTime(mode, "2006-01-02")
+}
+
+// GroupByMonth groups files by the calendar month of a timestamp
+func GroupByMonth(mode SortMode) GroupFunc {
+	return GroupByTime(mode, "2006-01")
+}
+
+// GroupByYear groups files by the year of a timestamp
+func GroupByYear(mode SortMode) GroupFunc {
+	return GroupByTime(mode, "2006")
+}
+
+// groupFiles splits the sorted files into groups, keeping their order.
+// Groups are returned in the order of their first file.
+func groupFiles(files []FileInfo, opts Options) ([]string, map[string][]FileInfo) {
+	if opts.Group == nil {
+		return []string{""}, map[string][]FileInfo{"": files}
+	}
+
+	var keys []string
+	groups := make(map[string][]FileInfo)
+	for _, fi := range files {
+		key := opts.Group(fi)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], fi)
+	}
+	return keys, groups
+}
@@ -0,0 +1,162 @@
+package renby
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildPlan_GroupByDir(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var files []string
+	files = append(files, writeSizedFiles(t, filepath.Join(root, "a"), map[string]int{"x.txt": 1, "y.txt": 4, "z.txt": 5})...)
+	files = append(files, writeSizedFiles(t, filepath.Join(root, "b"), map[string]int{"x.txt": 2, "y.txt": 3})...)
+
+	tests := []struct {
+		name string
+		opts Options
+		want map[string]string
+	}{
+		{
+			name: "global sequence",
+			opts: Options{Pattern: "0", FileMode: SortBySize, Init: 1},
+			want: map[string]string{"a/x.txt": "a/1.txt", "b/x.txt": "b/2.txt", "b/y.txt": "b/3.txt", "a/y.txt": "a/4.txt", "a/z.txt": "a/5.txt"},
+		},
+		{
+			name: "per directory",
+			opts: Options{Pattern: "0", FileMode: SortBySize, Init: 1, Group: GroupByDir},
+			want: map[string]string{"a/x.txt": "a/1.txt", "a/y.txt": "a/2.txt", "a/z.txt": "a/3.txt", "b/x.txt": "b/1.txt", "b/y.txt": "b/2.txt"},
+		},
+		{
+			name: "per directory with init and step",
+			opts: Options{Pattern: "00", FileMode: SortBySize, Init: 10, Step: 10, Group: GroupByDir},
+			want: map[string]string{"a/x.txt": "a/10.txt", "a/y.txt": "a/20.txt", "a/z.txt": "a/30.txt", "b/x.txt": "b/10.txt", "b/y.txt": "b/20.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := BuildPlan(files, tt.opts)
+			if err != nil {
+				t.Fatalf("BuildPlan() error = %v", err)
+			}
+			if plan.HasConflicts() {
+				t.Fatalf("unexpected conflicts: %v", plan.Conflicts)
+			}
+			for _, e := range plan.Entries {
+				src, _ := filepath.Rel(root, e.Source)
+				dst, _ := filepath.Rel(root, e.Destination)
+				if want := tt.want[filepath.ToSlash(src)]; filepath.ToSlash(dst) != want {
+					t.Errorf("%s -> %s, want %s", src, dst, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildPlan_GroupAppend(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSizedFiles(t, filepath.Join(root, "a"), map[string]int{"05.txt": 0})
+	files := writeSizedFiles(t, filepath.Join(root, "a"), map[string]int{"new.txt": 1})
+	files = append(files, writeSizedFiles(t, filepath.Join(root, "b"), map[string]int{"new.txt": 2})...)
+
+	plan, err := BuildPlan(files, Options{Pattern: "00", FileMode: SortBySize, Init: 1, Append: true, Group: GroupByDir})
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+	want := []string{filepath.Join(root, "a", "06.txt"), filepath.Join(root, "b", "01.txt")}
+	for i, e := range plan.Entries {
+		if e.Destination != want[i] {
+			t.Errorf("entry %d destination = %q, want %q", i, e.Destination, want[i])
+		}
+	}
+}
+
+func TestBuildPlan_GroupByExtAndTime(t *testing.T) {
+	dir := t.TempDir()
+	day1 := time.Date(2024, 5, 1, 9, 0, 0, 0, time.Local)
+	day2 := time.Date(2024, 5, 2, 9, 0, 0, 0, time.Local)
+	mtimes := map[string]time.Time{
+		"a.CR2": day1,
+		"a.jpg": day1.Add(time.Minute),
+		"b.cr2": day1.Add(2 * time.Minute),
+		"c.jpg": day2,
+		"c.cr2": day2.Add(time.Minute),
+	}
+	var files []string
+	for name, mtime := range mtimes {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want map[string]string
+	}{
+		{
+			name: "extension",
+			opts: Options{Pattern: "00", FileMode: SortByModificationTime, Init: 1, Group: GroupByExt},
+			want: map[string]string{"a.CR2": "01.CR2", "b.cr2": "02.cr2", "c.cr2": "03.cr2", "a.jpg": "01.jpg", "c.jpg": "02.jpg"},
+		},
+		{
+			name: "day with date in the name",
+			opts: Options{Template: "{time:0102}_{n}{ext}", FileMode: SortByModificationTime, Init: 1, Group: GroupByDay(SortByModificationTime)},
+			want: map[string]string{"a.CR2": "0501_1.CR2", "a.jpg": "0501_2.jpg", "b.cr2": "0501_3.cr2", "c.jpg": "0502_1.jpg", "c.cr2": "0502_2.cr2"},
+		},
+		{
+			name: "month",
+			opts: Options{Pattern: "0", FileMode: SortByModificationTime, Init: 1, Group: GroupByMonth(SortByModificationTime)},
+			want: map[string]string{"a.CR2": "1.CR2", "a.jpg": "2.jpg", "b.cr2": "3.cr2", "c.jpg": "4.jpg", "c.cr2": "5.cr2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := BuildPlan(files, tt.opts)
+			if err != nil {
+				t.Fatalf("BuildPlan() error = %v", err)
+			}
+			for _, e := range plan.Entries {
+				src := filepath.Base(e.Source)
+				if got := filepath.Base(e.Destination); got != tt.want[src] {
+					t.Errorf("%s -> %s, want %s", src, got, tt.want[src])
+				}
+			}
+		})
+	}
+}
+
+func TestOptions_SortTime(t *testing.T) {
+	tests := []struct {
+		opts Options
+		want SortMode
+	}{
+		{Options{FileMode: SortByCreationTime}, SortByCreationTime},
+		{Options{FileMode: SortBySize}, SortByModificationTime},
+		{Options{SortKeys: []SortKey{{Mode: SortByName}, {Mode: SortByCaptureTime}}}, SortByCaptureTime},
+	}
+
+	for _, tt := range tests {
+		if got := tt.opts.SortTime(); got != tt.want {
+			t.Errorf("SortTime() = %v, want %v", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Package exif reads the capture date of JPEG and TIFF based images.
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNoExif is returned when the file carries no usable capture date
+var ErrNoExif = errors.New("no EXIF capture date")
+
+const (
+	tagExifIFD            = 0x8769
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagSubSecTimeOriginal = 0x9291
+
+	typeASCII = 2
+	typeLong  = 4
+
+	maxIFDEntries = 1024
+	dateLayout    = "2006:01:02 15:04:05"
+)
+
+// ReadCaptureTime returns the DateTimeOriginal of the image at path,
+// refined by SubSecTimeOriginal and OffsetTimeOriginal when present.
+// Without an offset tag the date is interpreted in the local time zone.
+func ReadCaptureTime(path string) (time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return CaptureTime(file, info.Size())
+}
+
+// CaptureTime reads the capture date from a JPEG or TIFF stream of the given size
+func CaptureTime(r io.ReaderAt, size int64) (time.Time, error) {
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return time.Time{}, ErrNoExif
+	}
+
+	switch {
+	case magic[0] == 0xFF && magic[1] == 0xD8:
+		tiff, err := jpegExif(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return tiffCaptureTime(bytes.NewReader(tiff))
+	case string(magic[:]) == "II*\x00" || string(magic[:]) == "MM\x00*":
+		return tiffCaptureTime(r)
+	default:
+		return time.Time{}, ErrNoExif
+	}
+}
+
+// jpegExif returns the TIFF payload of the APP1 Exif segment
+func jpegExif(r io.Reader) ([]byte, error) {
+	br := &byteReader{r: r}
+	if br.byte() != 0xFF || br.byte() != 0xD8 {
+		return nil, ErrNoExif
+	}
+
+	for br.err == nil {
+		if br.byte() != 0xFF {
+			return nil, ErrNoExif
+		}
+		marker := br.byte()
+		for marker == 0xFF { // fill bytes
+			marker = br.byte()
+		}
+		switch {
+		case marker == 0xD9 || marker == 0xDA: // EOI, SOS: no metadata follows
+			return nil, ErrNoExif
+		case marker == 0x01 || (0xD0 <= marker && marker <= 0xD7): // standalone markers
+			continue
+		}
+
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil || length < 2 {
+			return nil, ErrNoExif
+		}
+		payload := make([]byte, length-2)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, ErrNoExif
+		}
+		if marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			return payload[6:], nil
+		}
+	}
+	return nil, ErrNoExif
+}
+
+// byteReader reads single bytes and remembers the first error
+type byteReader struct {
+	r   io.Reader
+	err error
+}
+
+func (b *byteReader) byte() byte {
+	var buf [1]byte
+	if b.err == nil {
+		_, b.err = io.ReadFull(b.r, buf[:])
+	}
+	return buf[0]
+}
+
+// ifdEntry is a raw TIFF directory entry
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value [4]byte // inline value or offset
+}
+
+// tiffReader reads TIFF structures in the stream byte order
+type tiffReader struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+}
+
+func tiffCaptureTime(r io.ReaderAt) (time.Time, error) {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return time.Time{}, ErrNoExif
+	}
+
+	t := &tiffReader{r: r}
+	switch string(header[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return time.Time{}, ErrNoExif
+	}
+	if t.order.Uint16(header[2:4]) != 42 {
+		return time.Time{}, ErrNoExif
+	}
+
+	ifd0, err := t.readIFD(t.order.Uint32(header[4:8]))
+	if err != nil {
+		return time.Time{}, err
+	}
+	ptr, ok := ifd0[tagExifIFD]
+	if !ok || ptr.typ != typeLong {
+		return time.Time{}, ErrNoExif
+	}
+	exifIFD, err := t.readIFD(t.order.Uint32(ptr.value[:]))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	original, err := t.ascii(exifIFD, tagDateTimeOriginal)
+	if err != nil || original == "" {
+		return time.Time{}, ErrNoExif
+	}
+	subsec, _ := t.ascii(exifIFD, tagSubSecTimeOriginal)
+	offset, _ := t.ascii(exifIFD, tagOffsetTimeOriginal)
+	return parseDateTime(original, subsec, offset)
+}
+
+func (t *tiffReader) readIFD(offset uint32) (map[uint16]ifdEntry, error) {
+	var buf [2]byte
+	if _, err := t.r.ReadAt(buf[:], int64(offset)); err != nil {
+		return nil, ErrNoExif
+	}
+	n := t.order.Uint16(buf[:])
+	if n > maxIFDEntries {
+		return nil, ErrNoExif
+	}
+
+	data := make([]byte, int(n)*12)
+	if _, err := t.r.ReadAt(data, int64(offset)+2); err != nil {
+		return nil, ErrNoExif
+	}
+	entries := make(map[uint16]ifdEntry, n)
+	for i := 0; i < int(n); i++ {
+		raw := data[i*12 : i*12+12]
+		e := ifdEntry{typ: t.order.Uint16(raw[2:4]), count: t.order.Uint32(raw[4:8])}
+		copy(e.value[:], raw[8:12])
+		entries[t.order.Uint16(raw[0:2])] = e
+	}
+	return entries, nil
+}
+
+// ascii returns the NUL-terminated ASCII value of tag
+func (t *tiffReader) ascii(ifd map[uint16]ifdEntry, tag uint16) (string, error) {
+	e, ok := ifd[tag]
+	if !ok || e.typ != typeASCII || e.count > 256 {
+		return "", ErrNoExif
+	}
+
+	data := e.value[:]
+	if e.count > 4 {
+		data = make([]byte, e.count)
+		if _, err := t.r.ReadAt(data, int64(t.order.Uint32(e.value[:]))); err != nil {
+			return "", ErrNoExif
+		}
+	} else {
+		data = data[:e.count]
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// parseDateTime combines DateTimeOriginal, SubSecTimeOriginal and OffsetTimeOriginal
+func parseDateTime(original, subsec, offset string) (time.Time, error) {
+	loc := time.Local
+	if offset != "" {
+		o, err := time.Parse("-07:00", offset)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid EXIF time offset %q", offset)
+		}
+		_, secs := o.Zone()
+		loc = time.FixedZone(offset, secs)
+	}
+
+	t, err := time.ParseInLocation(dateLayout, original, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid EXIF date %q", original)
+	}
+
+	if subsec = strings.TrimRight(subsec, " "); subsec != "" {
+		if len(subsec) > 9 {
+			subsec = subsec[:9]
+		}
+		ns := 0
+		for i := 0; i < 9; i++ {
+			ns *= 10
+			if i < len(subsec) {
+				if subsec[i] < '0' || subsec[i] > '9' {
+					return time.Time{}, fmt.Errorf("invalid EXIF sub-second %q", subsec)
+				}
+				ns += int(subsec[i] - '0')
+			}
+		}
+		t = t.Add(time.Duration(ns))
+	}
+	return t, nil
+}
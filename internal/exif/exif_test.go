@@ -0,0 +1,133 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// buildTIFF returns a TIFF structure whose Exif IFD holds the given ASCII tags
+func buildTIFF(order binary.ByteOrder, tags map[uint16]string) []byte {
+	var buf bytes.Buffer
+	if order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(&buf, order, uint16(42))
+	binary.Write(&buf, order, uint32(8))
+
+	// IFD0 at 8: a single entry pointing to the Exif IFD at 26
+	binary.Write(&buf, order, uint16(1))
+	binary.Write(&buf, order, uint16(tagExifIFD))
+	binary.Write(&buf, order, uint16(typeLong))
+	binary.Write(&buf, order, uint32(1))
+	binary.Write(&buf, order, uint32(26))
+	binary.Write(&buf, order, uint32(0))
+
+	// Exif IFD at 26, values stored after it
+	ids := []uint16{tagDateTimeOriginal, tagOffsetTimeOriginal, tagSubSecTimeOriginal}
+	var present []uint16
+	for _, id := range ids {
+		if _, ok := tags[id]; ok {
+			present = append(present, id)
+		}
+	}
+	valueOffset := uint32(26 + 2 + 12*len(present) + 4)
+	var values bytes.Buffer
+	binary.Write(&buf, order, uint16(len(present)))
+	for _, id := range present {
+		value := append([]byte(tags[id]), 0)
+		binary.Write(&buf, order, id)
+		binary.Write(&buf, order, uint16(typeASCII))
+		binary.Write(&buf, order, uint32(len(value)))
+		if len(value) <= 4 {
+			var inline [4]byte
+			copy(inline[:], value)
+			buf.Write(inline[:])
+		} else {
+			binary.Write(&buf, order, valueOffset+uint32(values.Len()))
+			values.Write(value)
+		}
+	}
+	binary.Write(&buf, order, uint32(0))
+	buf.Write(values.Bytes())
+	return buf.Bytes()
+}
+
+// buildJPEG wraps a TIFF structure in a minimal JPEG with an APP0 and APP1 segment
+func buildJPEG(tiff []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xD8})
+	buf.Write([]byte{0xFF, 0xE0, 0x00, 0x07, 'J', 'F', 'I', 'F', 0x00})
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	buf.Write([]byte{0xFF, 0xE1})
+	binary.Write(&buf, binary.BigEndian, uint16(len(payload)+2))
+	buf.Write(payload)
+	buf.Write([]byte{0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9})
+	return buf.Bytes()
+}
+
+func TestCaptureTime(t *testing.T) {
+	tags := map[uint16]string{
+		tagDateTimeOriginal:   "2023:07:14 09:30:15",
+		tagSubSecTimeOriginal: "25",
+		tagOffsetTimeOriginal: "+09:00",
+	}
+	want := time.Date(2023, 7, 14, 9, 30, 15, 250_000_000, time.FixedZone("", 9*60*60))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "jpeg little endian", data: buildJPEG(buildTIFF(binary.LittleEndian, tags))},
+		{name: "jpeg big endian", data: buildJPEG(buildTIFF(binary.BigEndian, tags))},
+		{name: "tiff", data: buildTIFF(binary.LittleEndian, tags)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CaptureTime(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatalf("CaptureTime() error = %v", err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("CaptureTime() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCaptureTime_LocalWithoutOffset(t *testing.T) {
+	data := buildJPEG(buildTIFF(binary.LittleEndian, map[uint16]string{tagDateTimeOriginal: "2020:01:02 03:04:05"}))
+	got, err := CaptureTime(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("CaptureTime() error = %v", err)
+	}
+	if want := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local); !got.Equal(want) {
+		t.Errorf("CaptureTime() = %v, want %v", got, want)
+	}
+}
+
+func TestCaptureTime_NoExif(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "not an image", data: []byte("hello world")},
+		{name: "jpeg without exif", data: []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9}},
+		{name: "truncated jpeg", data: []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x10}},
+		{name: "exif without date", data: buildJPEG(buildTIFF(binary.LittleEndian, nil))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CaptureTime(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if !errors.Is(err, ErrNoExif) {
+				t.Errorf("CaptureTime() error = %v, want ErrNoExif", err)
+			}
+		})
+	}
+}
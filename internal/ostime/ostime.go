@@ -1,9 +1,55 @@
 package ostime
 
-import "time"
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// Field identifies a timestamp of OsTime
+type Field uint8
+
+const (
+	Creation Field = 1 << iota
+	Change
+	Modification
+	Access
+)
 
 type OsTime struct {
-	CreationTime     time.Time
+	CreationTime     time.Time // birth time
+	ChangeTime       time.Time // inode (metadata) change time
 	ModificationTime time.Time
 	AccessTime       time.Time
+	Genuine          Field // timestamps read from the filesystem, the others are fallbacks
+}
+
+// IsGenuine reports whether the timestamp f was read from the filesystem
+func (t OsTime) IsGenuine(f Field) bool {
+	return t.Genuine&f != 0
+}
+
+// GetOsTime returns the timestamps of the file at path.
+// Timestamps which are not available fall back along the chain
+// birth time -> change time -> modification time, and are not marked genuine.
+func GetOsTime(path string, info os.FileInfo) (OsTime, error) {
+	if info == nil {
+		return OsTime{}, errors.New("GetOsTime: os.FileInfo is nil")
+	}
+
+	t := sysTime(path, info)
+	if !t.IsGenuine(Modification) {
+		t.ModificationTime = info.ModTime()
+		t.Genuine |= Modification
+	}
+	if !t.IsGenuine(Change) {
+		t.ChangeTime = t.ModificationTime
+	}
+	if !t.IsGenuine(Creation) {
+		t.CreationTime = t.ChangeTime
+	}
+	if !t.IsGenuine(Access) {
+		t.AccessTime = t.ModificationTime
+	}
+	return t, nil
 }
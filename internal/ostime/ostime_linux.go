@@ -4,19 +4,96 @@ package ostime
 
 import (
 	"os"
+	"runtime"
 	"syscall"
 	"time"
+	"unsafe"
 )
 
-func GetOsTime(info os.FileInfo) OsTime {
+const (
+	atFdcwd    = -0x64 // AT_FDCWD
+	statxBtime = 0x800 // STATX_BTIME
+)
+
+// sysStatx is the statx(2) syscall number, which the syscall package
+// does not export on most architectures. Zero means unsupported.
+var sysStatx = map[string]uintptr{
+	"386":     383,
+	"amd64":   332,
+	"arm":     397,
+	"arm64":   291,
+	"loong64": 291,
+	"ppc64":   383,
+	"ppc64le": 383,
+	"riscv64": 291,
+	"s390x":   379,
+}[runtime.GOARCH]
+
+type statxTimestamp struct {
+	Sec  int64
+	Nsec uint32
+	_    int32
+}
+
+// statxT mirrors struct statx from <linux/stat.h>
+type statxT struct {
+	Mask           uint32
+	Blksize        uint32
+	Attributes     uint64
+	Nlink          uint32
+	Uid            uint32
+	Gid            uint32
+	Mode           uint16
+	_              uint16
+	Ino            uint64
+	Size           uint64
+	Blocks         uint64
+	AttributesMask uint64
+	Atime          statxTimestamp
+	Btime          statxTimestamp
+	Ctime          statxTimestamp
+	Mtime          statxTimestamp
+	RdevMajor      uint32
+	RdevMinor      uint32
+	DevMajor       uint32
+	DevMinor       uint32
+	_              [14]uint64
+}
+
+func sysTime(path string, info os.FileInfo) OsTime {
+	var t OsTime
+	if btime, ok := birthTime(path); ok {
+		t.CreationTime = btime
+		t.Genuine |= Creation
+	}
+
 	stat, ok := info.Sys().(*syscall.Stat_t)
 	if !ok {
-		panic("GetOsTime: os.FileInfo.Sys() is not a Stat_t")
+		return t
+	}
+	t.ChangeTime = time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec))
+	t.ModificationTime = time.Unix(int64(stat.Mtim.Sec), int64(stat.Mtim.Nsec))
+	t.AccessTime = time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec))
+	t.Genuine |= Change | Modification | Access
+	return t
+}
+
+// birthTime reads the birth time through statx(STATX_BTIME).
+// It reports false when the kernel or the filesystem does not provide it.
+func birthTime(path string) (time.Time, bool) {
+	if sysStatx == 0 {
+		return time.Time{}, false
+	}
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return time.Time{}, false
 	}
 
-	return OsTime{
-		CreationTime:     time.Unix(int64(stat.Ctim.Sec), int64(stat.Ctim.Nsec)),
-		ModificationTime: time.Unix(int64(stat.Mtim.Sec), int64(stat.Mtim.Nsec)),
-		AccessTime:       time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec)),
+	var stx statxT
+	dirfd := atFdcwd
+	_, _, errno := syscall.Syscall6(sysStatx, uintptr(dirfd), uintptr(unsafe.Pointer(p)), 0, statxBtime, uintptr(unsafe.Pointer(&stx)), 0)
+	if errno != 0 || stx.Mask&statxBtime == 0 {
+		return time.Time{}, false
 	}
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), true
 }
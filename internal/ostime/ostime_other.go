@@ -4,10 +4,7 @@ package ostime
 
 import "os"
 
-func GetOsTime(info os.FileInfo) OsTime {
-	return OsTime{
-		CreationTime:     info.ModTime(), // Fallback for systems without specific creation time
-		ModificationTime: info.ModTime(),
-		AccessTime:       info.ModTime(), // Fallback for systems without specific access time
-	}
+// sysTime has no system-specific timestamps; GetOsTime falls back to the modification time
+func sysTime(path string, info os.FileInfo) OsTime {
+	return OsTime{}
 }
@@ -0,0 +1,40 @@
+package ostime
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestGetOsTime_Fallback(t *testing.T) {
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{"a.txt": &fstest.MapFile{Data: []byte("a"), ModTime: mtime}}
+	info, err := fsys.Stat("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetOsTime("does/not/exist/a.txt", info)
+	if err != nil {
+		t.Fatalf("GetOsTime() error = %v", err)
+	}
+	if got.Genuine != Modification {
+		t.Errorf("Genuine = %b, want only Modification", got.Genuine)
+	}
+	for name, ts := range map[string]time.Time{
+		"CreationTime":     got.CreationTime,
+		"ChangeTime":       got.ChangeTime,
+		"ModificationTime": got.ModificationTime,
+		"AccessTime":       got.AccessTime,
+	} {
+		if !ts.Equal(mtime) {
+			t.Errorf("%s = %v, want fallback %v", name, ts, mtime)
+		}
+	}
+}
+
+func TestGetOsTime_Nil(t *testing.T) {
+	if _, err := GetOsTime("a.txt", nil); err == nil {
+		t.Error("GetOsTime() error = nil, want error")
+	}
+}
@@ -8,15 +8,16 @@ import (
 	"time"
 )
 
-func GetOsTime(info os.FileInfo) OsTime {
+func sysTime(path string, info os.FileInfo) OsTime {
 	stat, ok := info.Sys().(*syscall.Win32FileAttributeData)
 	if !ok {
-		panic("GetOsTime: os.FileInfo.Sys() is not a Win32FileAttributeData")
+		return OsTime{}
 	}
 
 	return OsTime{
 		CreationTime:     time.Unix(0, stat.CreationTime.Nanoseconds()),
 		ModificationTime: time.Unix(0, stat.LastWriteTime.Nanoseconds()),
 		AccessTime:       time.Unix(0, stat.LastAccessTime.Nanoseconds()),
+		Genuine:          Creation | Modification | Access, // Change time is not provided by Win32FileAttributeData
 	}
 }
@@ -0,0 +1,425 @@
+package renby
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	journalExt    = ".jsonl"
+	undoneExt     = ".undone"
+	journalFormat = 1
+)
+
+// Journal step operations besides the names of the modes creating files
+const (
+	opRename = ""       // From renamed to To
+	opRemove = "remove" // To removed while rolling back
+)
+
+// ErrNoJournal is returned when no journal is available for undo
+var ErrNoJournal = errors.New("no journal found")
+
+// JournalStep represents a completed step recorded in a journal.
+// Op is empty for a rename, the mode name ("copy", "hardlink",
+// "symlink") when To was created from From, or "remove" when To was
+// removed again. Size and ModTime describe the file at To right after the step.
+type JournalStep struct {
+	Op      string    `json:"op,omitempty"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// Journal represents a recorded rename batch
+type Journal struct {
+	Path  string
+	Time  time.Time
+	Steps []JournalStep
+}
+
+// journalHeader is the first line of a journal file
+type journalHeader struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+}
+
+// journalWriter appends completed steps to a journal file.
+// The file is created by open once a batch is going to rename files.
+type journalWriter struct {
+	dir  string
+	file *os.File
+}
+
+// newJournalWriter returns a writer for dir, or nil when journaling is disabled
+func newJournalWriter(dir string) *journalWriter {
+	if dir == "" {
+		return nil
+	}
+	return &journalWriter{dir: dir}
+}
+
+// open creates the journal file and writes its header
+func (w *journalWriter) open() error {
+	if w == nil {
+		return nil
+	}
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-%d%s", now.UTC().Format("20060102T150405.000000000"), os.Getpid(), journalExt)
+	file, err := os.OpenFile(filepath.Join(w.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create journal: %w", err)
+	}
+	w.file = file
+	return w.writeLine(journalHeader{Version: journalFormat, Time: now})
+}
+
+// path returns the absolute path of the journal file, empty before open
+func (w *journalWriter) path() string {
+	if w == nil || w.file == nil {
+		return ""
+	}
+	path, err := filepath.Abs(w.file.Name())
+	if err != nil {
+		return w.file.Name()
+	}
+	return path
+}
+
+// record appends a completed step from -> to
+func (w *journalWriter) record(op, from, to string) error {
+	if w == nil || w.file == nil {
+		return nil
+	}
+
+	info, err := os.Lstat(to)
+	if err != nil {
+		return fmt.Errorf("failed to stat renamed file %q: %w", to, err)
+	}
+	// undo may run from another working directory
+	if from, err = filepath.Abs(from); err != nil {
+		return fmt.Errorf("failed to resolve %q: %w", from, err)
+	}
+	if to, err = filepath.Abs(to); err != nil {
+		return fmt.Errorf("failed to resolve %q: %w", to, err)
+	}
+	return w.writeLine(JournalStep{Op: op, From: from, To: to, Size: info.Size(), ModTime: info.ModTime()})
+}
+
+// recordRemoval appends the removal of a file created by the batch
+func (w *journalWriter) recordRemoval(path string) error {
+	if w == nil || w.file == nil {
+		return nil
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %q: %w", path, err)
+	}
+	return w.writeLine(JournalStep{Op: opRemove, To: path})
+}
+
+func (w *journalWriter) writeLine(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := w.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+// close flushes the journal to disk
+func (w *journalWriter) close() error {
+	if w == nil || w.file == nil {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	return w.file.Close()
+}
+
+// discard closes and removes the journal of a batch which has been rolled back
+func (w *journalWriter) discard() error {
+	if w == nil || w.file == nil {
+		return nil
+	}
+	path := w.file.Name()
+	w.file.Close()
+	w.file = nil
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove journal: %w", err)
+	}
+	return nil
+}
+
+// ReadJournal loads a journal file
+func ReadJournal(path string) (*Journal, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read journal: %w", err)
+		}
+		return nil, fmt.Errorf("journal %q is empty", path)
+	}
+	var header journalHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, fmt.Errorf("invalid journal header in %q: %w", path, err)
+	}
+	if header.Version != journalFormat {
+		return nil, fmt.Errorf("unsupported journal version %d in %q", header.Version, path)
+	}
+
+	journal := &Journal{Path: path, Time: header.Time}
+	for line := 2; scanner.Scan(); line++ {
+		var step JournalStep
+		if err := json.Unmarshal(scanner.Bytes(), &step); err != nil {
+			return nil, fmt.Errorf("invalid journal entry at %s:%d: %w", path, line, err)
+		}
+		journal.Steps = append(journal.Steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	return journal, nil
+}
+
+// rewriteJournal replaces the steps of the two-phase entries recorded in the
+// journal at path by the steps of the completed entries. Steps of other
+// entries are kept. A journal marked as undone after every step was dropped
+// by dropJournalSteps is brought back, any other missing journal is left alone.
+func rewriteJournal(path string, entries []intentEntry) error {
+	if path == "" {
+		return nil
+	}
+	journal, err := ReadJournal(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// another directory of the batch has been reverted
+		journal, err = ReadJournal(path + undoneExt)
+		if errors.Is(err, os.ErrNotExist) || (err == nil && len(journal.Steps) > 0) {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	steps := journal.stepsWithout(entries)
+	completed := make([]JournalStep, len(entries))
+	for i, e := range entries {
+		info, err := os.Lstat(e.Destination)
+		if err != nil {
+			return fmt.Errorf("failed to stat renamed file %q: %w", e.Destination, err)
+		}
+		completed[i] = JournalStep{From: e.Temp, To: e.Destination, Size: info.Size(), ModTime: info.ModTime()}
+		steps = append(steps, JournalStep{Op: e.Op, From: e.Source, To: e.Temp, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	steps = append(steps, completed...)
+
+	if err := writeJournal(path, journal.Time, steps); err != nil {
+		return err
+	}
+	if journal.Path != path {
+		if err := os.Remove(journal.Path); err != nil {
+			return fmt.Errorf("failed to rewrite journal: %w", err)
+		}
+	}
+	return nil
+}
+
+// dropJournalSteps removes the steps of the reverted two-phase entries from
+// the journal at path, which other directories of the batch may share.
+// The journal is marked as undone once no step remains. A missing journal
+// is left alone.
+func dropJournalSteps(path string, entries []intentEntry) error {
+	if path == "" {
+		return nil
+	}
+	journal, err := ReadJournal(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	steps := journal.stepsWithout(entries)
+	if err := writeJournal(path, journal.Time, steps); err != nil {
+		return err
+	}
+	if len(steps) > 0 {
+		return nil
+	}
+	// an empty undone journal tells rewriteJournal that nothing was undone
+	if err := os.Rename(path, path+undoneExt); err != nil {
+		return fmt.Errorf("failed to mark journal as undone: %w", err)
+	}
+	return nil
+}
+
+// stepsWithout returns the steps of the journal which do not belong to the
+// two-phase entries
+func (j *Journal) stepsWithout(entries []intentEntry) []JournalStep {
+	own := make(map[[2]string]struct{}, 2*len(entries))
+	for _, e := range entries {
+		own[[2]string{e.Source, e.Temp}] = struct{}{}
+		own[[2]string{e.Temp, e.Destination}] = struct{}{}
+	}
+	var steps []JournalStep
+	for _, step := range j.Steps {
+		if _, ok := own[[2]string{step.From, step.To}]; !ok {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// writeJournal atomically replaces the journal at path
+func writeJournal(path string, t time.Time, steps []JournalStep) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(journalHeader{Version: journalFormat, Time: t}); err != nil {
+		return err
+	}
+	for _, step := range steps {
+		if err := enc.Encode(step); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to rewrite journal: %w", err)
+	}
+	return nil
+}
+
+// LatestJournal returns the most recent journal in dir which has not been undone
+func LatestJournal(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrNoJournal
+		}
+		return "", fmt.Errorf("failed to read journal directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), journalExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", ErrNoJournal
+	}
+	sort.Strings(names)
+	return filepath.Join(dir, names[len(names)-1]), nil
+}
+
+// Undo reverses the batch recorded in the journal at path.
+// It refuses to touch any file when a renamed file has since been
+// modified, moved or deleted, or when an original name is taken again.
+// Files the batch created by copying or linking are removed.
+// On success the journal is marked as undone.
+func Undo(path string) error {
+	journal, err := ReadJournal(path)
+	if err != nil {
+		return err
+	}
+	if err := journal.verify(); err != nil {
+		return fmt.Errorf("cannot undo: %w", err)
+	}
+
+	for i := len(journal.Steps) - 1; i >= 0; i-- {
+		step := journal.Steps[i]
+		switch step.Op {
+		case opRename:
+			if err := moveFile(step.To, step.From); err != nil {
+				return fmt.Errorf("failed to restore %q to %q: %w", step.To, step.From, err)
+			}
+		case opRemove:
+			// removed while rolling back, the step creating it finds it gone
+		default:
+			if err := os.Remove(step.To); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %q: %w", step.To, err)
+			}
+		}
+	}
+
+	if err := os.Rename(path, path+undoneExt); err != nil {
+		return fmt.Errorf("failed to mark journal as undone: %w", err)
+	}
+	return nil
+}
+
+// verify checks that reversing the journal steps is safe
+func (j *Journal) verify() error {
+	// Final location of every renamed file -> the step which put it there
+	current := make(map[string]JournalStep)
+	for _, step := range j.Steps {
+		switch step.Op {
+		case opRename:
+			delete(current, step.From)
+			current[step.To] = step
+		case opRemove:
+			delete(current, step.To)
+		default:
+			current[step.To] = step
+		}
+	}
+
+	for path, step := range current {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return fmt.Errorf("%q has been moved or deleted since the rename", path)
+		}
+		if info.Size() != step.Size || !info.ModTime().Equal(step.ModTime) {
+			return fmt.Errorf("%q has been modified since the rename", path)
+		}
+	}
+
+	// Replay the reversal to make sure no original name is taken
+	occupied := make(map[string]struct{}, len(current))
+	for path := range current {
+		occupied[path] = struct{}{}
+	}
+	for i := len(j.Steps) - 1; i >= 0; i-- {
+		step := j.Steps[i]
+		delete(occupied, step.To)
+		if step.Op != opRename {
+			continue // the source was left in place
+		}
+		if _, taken := occupied[step.From]; taken {
+			return fmt.Errorf("original name %q is taken by another file of the batch", step.From)
+		}
+		if _, renamed := current[step.From]; !renamed {
+			if _, err := os.Lstat(step.From); err == nil {
+				return fmt.Errorf("original name %q is already in use", step.From)
+			}
+		}
+		occupied[step.From] = struct{}{}
+	}
+	return nil
+}
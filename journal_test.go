@@ -0,0 +1,187 @@
+package renby
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read dir: %v", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestUndo(t *testing.T) {
+	tests := []struct {
+		name      string
+		force     bool
+		wantSteps int
+	}{
+		{name: "direct rename", force: false, wantSteps: 3},
+		{name: "two-phase rename", force: true, wantSteps: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			journalDir := t.TempDir()
+			files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20, "c.txt": 30})
+			original := listNames(t, dir)
+
+			opts := Options{Pattern: "000", FileMode: SortBySize, Init: 1, ForceOverwrite: tt.force, JournalDir: journalDir}
+			if err := RenameFiles(files, opts); err != nil {
+				t.Fatalf("RenameFiles() error = %v", err)
+			}
+			if got, want := listNames(t, dir), []string{"001.txt", "002.txt", "003.txt"}; !slices.Equal(got, want) {
+				t.Fatalf("names after rename = %v, want %v", got, want)
+			}
+
+			path, err := LatestJournal(journalDir)
+			if err != nil {
+				t.Fatalf("LatestJournal() error = %v", err)
+			}
+			journal, err := ReadJournal(path)
+			if err != nil {
+				t.Fatalf("ReadJournal() error = %v", err)
+			}
+			if len(journal.Steps) != tt.wantSteps {
+				t.Errorf("journal has %d steps, want %d", len(journal.Steps), tt.wantSteps)
+			}
+			if tt.force && !strings.Contains(journal.Steps[0].To, ".renby.tmp.") {
+				t.Errorf("first step should move to a temp name, got %q", journal.Steps[0].To)
+			}
+
+			if err := Undo(path); err != nil {
+				t.Fatalf("Undo() error = %v", err)
+			}
+			if got := listNames(t, dir); !slices.Equal(got, original) {
+				t.Errorf("names after undo = %v, want %v", got, original)
+			}
+			if _, err := LatestJournal(journalDir); !errors.Is(err, ErrNoJournal) {
+				t.Errorf("LatestJournal() after undo error = %v, want ErrNoJournal", err)
+			}
+		})
+	}
+}
+
+func TestUndo_Refuse(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(t *testing.T, dir string)
+		wantErr string
+	}{
+		{
+			name: "modified",
+			tamper: func(t *testing.T, dir string) {
+				if err := os.WriteFile(filepath.Join(dir, "1.txt"), []byte("changed"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "has been modified",
+		},
+		{
+			name: "touched",
+			tamper: func(t *testing.T, dir string) {
+				future := time.Now().Add(time.Hour)
+				if err := os.Chtimes(filepath.Join(dir, "1.txt"), future, future); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "has been modified",
+		},
+		{
+			name: "moved",
+			tamper: func(t *testing.T, dir string) {
+				if err := os.Rename(filepath.Join(dir, "1.txt"), filepath.Join(dir, "moved.txt")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "has been moved or deleted",
+		},
+		{
+			name: "original name reused",
+			tamper: func(t *testing.T, dir string) {
+				if err := os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "already in use",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			journalDir := t.TempDir()
+			files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20})
+
+			opts := Options{Pattern: "0", FileMode: SortBySize, Init: 1, JournalDir: journalDir}
+			if err := RenameFiles(files, opts); err != nil {
+				t.Fatalf("RenameFiles() error = %v", err)
+			}
+			tt.tamper(t, dir)
+			before := listNames(t, dir)
+
+			path, err := LatestJournal(journalDir)
+			if err != nil {
+				t.Fatalf("LatestJournal() error = %v", err)
+			}
+			err = Undo(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Undo() error = %v, want error containing %q", err, tt.wantErr)
+			}
+			if got := listNames(t, dir); !slices.Equal(got, before) {
+				t.Errorf("refused undo touched files: got %v, want %v", got, before)
+			}
+		})
+	}
+}
+
+func TestRenameFiles_NoJournalWithoutRenames(t *testing.T) {
+	dir := t.TempDir()
+	journalDir := filepath.Join(t.TempDir(), "journal")
+	files := writeSizedFiles(t, dir, map[string]int{"1.txt": 10})
+
+	opts := Options{Pattern: "0", FileMode: SortBySize, Init: 1, JournalDir: journalDir}
+	if err := RenameFiles(files, opts); err != nil {
+		t.Fatalf("RenameFiles() error = %v", err)
+	}
+	if _, err := LatestJournal(journalDir); !errors.Is(err, ErrNoJournal) {
+		t.Errorf("LatestJournal() error = %v, want ErrNoJournal", err)
+	}
+}
+
+func TestApply_UnusableJournalDir(t *testing.T) {
+	dir := t.TempDir()
+	files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20})
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, force := range []bool{false, true} {
+		opts := Options{Pattern: "0", FileMode: SortBySize, Init: 1, ForceOverwrite: force, JournalDir: filepath.Join(blocker, "journal")}
+		err := RenameFiles(files, opts)
+		var rbErr *RollbackError
+		if err == nil || errors.As(err, &rbErr) {
+			t.Fatalf("force=%v: RenameFiles() error = %v, want a journal error before renaming", force, err)
+		}
+		if got, want := listNames(t, dir), []string{"a.txt", "b.txt"}; !slices.Equal(got, want) {
+			t.Errorf("force=%v: names = %v, want %v", force, got, want)
+		}
+	}
+}
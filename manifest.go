@@ -0,0 +1,123 @@
+package renby
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Mapping is a single rename read from a manifest or an editor
+type Mapping struct {
+	Source      string
+	Destination string
+}
+
+// manifestHeader is the header row written by WriteManifest
+var manifestHeader = []string{"index", "source", "destination", "key"}
+
+// WriteManifest writes the entries of the plan as CSV, or TSV when comma is '\t'.
+// The header row is index, source, destination, key.
+func WriteManifest(w io.Writer, plan *Plan, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write(manifestHeader); err != nil {
+		return err
+	}
+	for _, e := range plan.Entries {
+		if err := cw.Write([]string{strconv.Itoa(e.Index), e.Source, e.Destination, e.Key}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadManifest reads the mappings of a CSV or TSV manifest. The header row
+// must name a source and a destination column; other columns are ignored.
+func ReadManifest(r io.Reader, comma rune) ([]Mapping, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("manifest is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	src, dst := -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "source":
+			src = i
+		case "destination":
+			dst = i
+		}
+	}
+	if src < 0 || dst < 0 {
+		return nil, fmt.Errorf("manifest header must contain source and destination columns")
+	}
+
+	var mappings []Mapping
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest: %w", err)
+		}
+		if len(record) <= max(src, dst) {
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("manifest line %d: missing source or destination", line)
+		}
+		mappings = append(mappings, Mapping{Source: record[src], Destination: record[dst]})
+	}
+	return mappings, nil
+}
+
+// PlanFromMappings builds a plan renaming each source to its destination,
+// in the given order, with the same conflict detection as BuildPlan.
+// A relative destination is resolved against the directory of its source.
+// The naming and sorting fields of opts are ignored.
+func PlanFromMappings(mappings []Mapping, opts Options) (*Plan, error) {
+	entries := make([]PlanEntry, 0, len(mappings))
+	seen := make(map[string]struct{}, len(mappings))
+	for i, m := range mappings {
+		if m.Source == "" || m.Destination == "" {
+			return nil, fmt.Errorf("mapping %d: source and destination must not be empty", i+1)
+		}
+		src, err := filepath.Abs(m.Source)
+		if err != nil {
+			return nil, fmt.Errorf("mapping %d: %w", i+1, err)
+		}
+		if _, ok := seen[src]; ok {
+			return nil, fmt.Errorf("mapping %d: source %q is listed more than once", i+1, src)
+		}
+		seen[src] = struct{}{}
+
+		dst := m.Destination
+		if !filepath.IsAbs(dst) {
+			dst = filepath.Join(filepath.Dir(src), dst)
+		}
+		dst = filepath.Clean(dst)
+
+		fi, err := getFileInfo(src)
+		if err != nil {
+			return nil, fmt.Errorf("mapping %d: %w", i+1, err)
+		}
+		if fi == (FileInfo{}) {
+			return nil, fmt.Errorf("mapping %d: source %q is a directory", i+1, src)
+		}
+		entries = append(entries, PlanEntry{Source: src, Destination: dst, Index: i, Info: fi})
+	}
+
+	plan := &Plan{Entries: entries, opts: opts}
+	plan.detectConflicts()
+	return plan, nil
+}
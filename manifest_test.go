@@ -0,0 +1,122 @@
+package renby
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestManifest_RoundTrip(t *testing.T) {
+	for _, comma := range []rune{',', '\t'} {
+		t.Run(string(comma), func(t *testing.T) {
+			dir := t.TempDir()
+			files := writeSizedFiles(t, dir, map[string]int{"b, c.txt": 2, "a.txt": 1})
+
+			plan, err := BuildPlan(files, Options{Pattern: "0", FileMode: SortBySize, Init: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := WriteManifest(&buf, plan, comma); err != nil {
+				t.Fatalf("WriteManifest() error = %v", err)
+			}
+
+			mappings, err := ReadManifest(&buf, comma)
+			if err != nil {
+				t.Fatalf("ReadManifest() error = %v", err)
+			}
+			want := []Mapping{
+				{Source: filepath.Join(dir, "a.txt"), Destination: filepath.Join(dir, "1.txt")},
+				{Source: filepath.Join(dir, "b, c.txt"), Destination: filepath.Join(dir, "2.txt")},
+			}
+			if !reflect.DeepEqual(mappings, want) {
+				t.Errorf("ReadManifest() = %v, want %v", mappings, want)
+			}
+		})
+	}
+}
+
+func TestReadManifest_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "empty", input: ""},
+		{name: "no destination column", input: "source,target\na,b\n"},
+		{name: "short record", input: "source,destination\na\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadManifest(strings.NewReader(tt.input), ','); err == nil {
+				t.Error("ReadManifest() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestPlanFromMappings(t *testing.T) {
+	dir := t.TempDir()
+	writeSizedFiles(t, dir, map[string]int{"a.txt": 1, "b.txt": 2, "c.txt": 3})
+
+	// edited manifest: columns reordered, relative destination, extra column
+	manifest := "destination,note,source\n" +
+		"intro.txt,first," + filepath.Join(dir, "a.txt") + "\n" +
+		filepath.Join(dir, "outro.txt") + ",," + filepath.Join(dir, "b.txt") + "\n"
+	mappings, err := ReadManifest(strings.NewReader(manifest), ',')
+	if err != nil {
+		t.Fatalf("ReadManifest() error = %v", err)
+	}
+
+	plan, err := PlanFromMappings(mappings, Options{})
+	if err != nil {
+		t.Fatalf("PlanFromMappings() error = %v", err)
+	}
+	if plan.HasConflicts() {
+		t.Fatalf("unexpected conflicts: %v", plan.Conflicts)
+	}
+	if err := plan.Apply(context.Background()); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got, want := listNames(t, dir), []string{"c.txt", "intro.txt", "outro.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
+
+func TestPlanFromMappings_Conflicts(t *testing.T) {
+	dir := t.TempDir()
+	writeSizedFiles(t, dir, map[string]int{"a.txt": 1, "b.txt": 2, "c.txt": 3})
+	a, b, c := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "c.txt")
+
+	plan, err := PlanFromMappings([]Mapping{{a, "x.txt"}, {b, "x.txt"}, {c, "a.txt"}}, Options{})
+	if err != nil {
+		t.Fatalf("PlanFromMappings() error = %v", err)
+	}
+	kinds := map[ConflictKind]bool{}
+	for _, c := range plan.Conflicts {
+		kinds[c.Kind] = true
+	}
+	if !kinds[ConflictDuplicateDestination] || len(plan.Conflicts) != 1 {
+		t.Errorf("Conflicts = %v, want a single duplicate destination", plan.Conflicts)
+	}
+	if err := plan.Apply(context.Background()); err == nil {
+		t.Error("Apply() error = nil, want conflict error")
+	}
+
+	if _, err := PlanFromMappings([]Mapping{{a, "x.txt"}, {a, "y.txt"}}, Options{}); err == nil {
+		t.Error("PlanFromMappings() error = nil for a duplicate source")
+	}
+	if _, err := PlanFromMappings([]Mapping{{filepath.Join(dir, "missing.txt"), "y.txt"}}, Options{}); err == nil {
+		t.Error("PlanFromMappings() error = nil for a missing source")
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PlanFromMappings([]Mapping{{filepath.Join(dir, "sub"), "y"}}, Options{}); err == nil {
+		t.Error("PlanFromMappings() error = nil for a directory")
+	}
+}
@@ -0,0 +1,133 @@
+package renby
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// osRename performs renames, replaced in tests to simulate other filesystems
+var osRename = os.Rename
+
+// moveFile renames from to to. When they are on different filesystems,
+// from is copied next to to, synced, verified, renamed into place, the
+// directory is synced and only then from is removed, so that to never
+// holds a partial copy.
+func moveFile(from, to string) error {
+	err := osRename(from, to)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+	return moveAcross(from, to)
+}
+
+// isCrossDevice reports whether a rename failed because its paths are on different filesystems
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errCrossDevice)
+}
+
+// moveAcross moves from to to on another filesystem
+func moveAcross(from, to string) error {
+	info, err := os.Lstat(from)
+	if err != nil {
+		return err
+	}
+
+	part := partName(to)
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(from)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, part); err != nil {
+			return err
+		}
+	} else {
+		if err := copyFile(from, part); err != nil {
+			return fmt.Errorf("failed to copy %q across filesystems: %w", from, err)
+		}
+		if err := verifyCopy(from, part); err != nil {
+			os.Remove(part)
+			return err
+		}
+	}
+
+	if err := os.Rename(part, to); err != nil {
+		os.Remove(part)
+		return err
+	}
+	// the new entry must be on disk before the original disappears
+	if err := syncDir(filepath.Dir(to)); err != nil {
+		os.Remove(to)
+		return fmt.Errorf("failed to sync %q: %w", filepath.Dir(to), err)
+	}
+	if err := os.Remove(from); err != nil {
+		// keep the original; the copy would leave the file in two places
+		os.Remove(to)
+		return fmt.Errorf("failed to remove %q after copying it across filesystems: %w", from, err)
+	}
+	return nil
+}
+
+// partName returns the name a file is copied to before it is renamed to path
+func partName(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	return fmt.Sprintf("%s.renby.part.%d%s", base, os.Getpid(), ext)
+}
+
+// verifyCopy checks that copied has the size and content of original
+func verifyCopy(original, copied string) error {
+	same, err := sameContent(original, copied)
+	if err != nil {
+		return fmt.Errorf("failed to verify copy of %q: %w", original, err)
+	}
+	if !same {
+		return fmt.Errorf("copy of %q differs from the original", original)
+	}
+	return nil
+}
+
+// sameContent reports whether the files at a and b have the same size and SHA-256 hash
+func sameContent(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if infoA.Size() != infoB.Size() {
+		return false, nil
+	}
+
+	hashA, err := hashFile(a)
+	if err != nil {
+		return false, err
+	}
+	hashB, err := hashFile(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(hashA, hashB), nil
+}
+
+func hashFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,175 @@
+package renby
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// simulateDevices puts every directory on a filesystem of its own: renames
+// between different directories fail as they do between filesystems
+func simulateDevices(t *testing.T) {
+	t.Helper()
+	osRename = func(from, to string) error {
+		if filepath.Dir(from) != filepath.Dir(to) {
+			return &os.LinkError{Op: "rename", Old: from, New: to, Err: errCrossDevice}
+		}
+		return os.Rename(from, to)
+	}
+	sameFilesystem = func(path, dir string) (bool, error) {
+		return filepath.Dir(path) == dir, nil
+	}
+	t.Cleanup(func() {
+		osRename = os.Rename
+		sameFilesystem = sameDevice
+	})
+}
+
+func TestMoveFile_CrossDevice(t *testing.T) {
+	simulateDevices(t)
+	src, dst := filepath.Join(t.TempDir(), "a.txt"), filepath.Join(t.TempDir(), "b.txt")
+	if err := os.WriteFile(src, []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := moveFile(src, dst); err != nil {
+		t.Fatalf("moveFile() error = %v", err)
+	}
+	if _, err := os.Lstat(src); !os.IsNotExist(err) {
+		t.Errorf("source still exists: %v", err)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil || string(data) != "content" {
+		t.Fatalf("moved content = %q, %v", data, err)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 || !info.ModTime().Equal(mtime) {
+		t.Errorf("moved file mode %v mtime %v, want %v %v", info.Mode().Perm(), info.ModTime(), os.FileMode(0600), mtime)
+	}
+	if got := listNames(t, filepath.Dir(dst)); !slices.Equal(got, []string{"b.txt"}) {
+		t.Errorf("names in destination directory = %v, want no partial copy", got)
+	}
+}
+
+func TestMoveFile_CrossDeviceSymlink(t *testing.T) {
+	simulateDevices(t)
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "link"), filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink("target.txt", src); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	if err := moveFile(src, dst); err != nil {
+		t.Fatalf("moveFile() error = %v", err)
+	}
+	if target, err := os.Readlink(dst); err != nil || target != "target.txt" {
+		t.Errorf("moved link target = %q, %v, want %q", target, err, "target.txt")
+	}
+	if _, err := os.Lstat(src); !os.IsNotExist(err) {
+		t.Errorf("source link still exists: %v", err)
+	}
+}
+
+func TestSameContent(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"a": "content", "b": "content", "c": "CONTENT", "d": "longer content"}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"a", "b", true},
+		{"a", "c", false},
+		{"a", "d", false},
+	}
+	for _, tt := range tests {
+		got, err := sameContent(filepath.Join(dir, tt.a), filepath.Join(dir, tt.b))
+		if err != nil || got != tt.want {
+			t.Errorf("sameContent(%s, %s) = %v, %v, want %v", tt.a, tt.b, got, err, tt.want)
+		}
+	}
+	if _, err := sameContent(filepath.Join(dir, "a"), filepath.Join(dir, "missing")); err == nil {
+		t.Error("sameContent() with a missing file: error = nil, want error")
+	}
+}
+
+func TestApply_CrossDevice(t *testing.T) {
+	for _, force := range []bool{false, true} {
+		simulateDevices(t)
+		dir := t.TempDir()
+		outDir := filepath.Join(t.TempDir(), "usb")
+		journalDir := t.TempDir()
+		files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20})
+
+		opts := Options{Pattern: "0", FileMode: SortBySize, Init: 1, OutDir: outDir, ForceOverwrite: force, JournalDir: journalDir}
+		if err := RenameFiles(files, opts); err != nil {
+			t.Fatalf("force=%v: RenameFiles() error = %v", force, err)
+		}
+		if got, want := listNames(t, outDir), []string{"1.txt", "2.txt"}; !slices.Equal(got, want) {
+			t.Errorf("force=%v: names on the other device = %v, want %v", force, got, want)
+		}
+		if got := listNames(t, dir); len(got) != 0 {
+			t.Errorf("force=%v: sources left behind: %v", force, got)
+		}
+
+		// undo moves the files back across devices
+		path, err := LatestJournal(journalDir)
+		if err != nil {
+			t.Fatalf("LatestJournal() error = %v", err)
+		}
+		if err := Undo(path); err != nil {
+			t.Fatalf("force=%v: Undo() error = %v", force, err)
+		}
+		if got, want := listNames(t, dir), []string{"a.txt", "b.txt"}; !slices.Equal(got, want) {
+			t.Errorf("force=%v: names after undo = %v, want %v", force, got, want)
+		}
+	}
+}
+
+func TestRecover_CrossDevice(t *testing.T) {
+	for _, mode := range []RecoverMode{RecoverComplete, RecoverRevert} {
+		dir := t.TempDir()
+		src := filepath.Join(t.TempDir(), "a.txt")
+		if err := os.WriteFile(src, []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// phase one was interrupted after copying a.txt but before removing it
+		pid, counter := 99999, 0
+		dst := filepath.Join(dir, "1.txt")
+		e := intentEntry{Source: src, Temp: tempName(dst, pid, &counter), Backup: tempName(dst, pid, &counter), Destination: dst}
+		intent := newIntentLog(pid)
+		intent.add(e)
+		if err := intent.write(intentPhase1); err != nil {
+			t.Fatal(err)
+		}
+		if err := copyFile(src, e.Temp); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Recover(dir, mode); err != nil {
+			t.Fatalf("Recover() error = %v", err)
+		}
+		wantDst, wantSrc := mode == RecoverComplete, mode == RecoverRevert
+		if exists(dst) != wantDst || exists(src) != wantSrc {
+			t.Errorf("mode %v: destination exists %v, source exists %v", mode, exists(dst), exists(src))
+		}
+		if exists(e.Temp) {
+			t.Errorf("mode %v: temp %q left behind", mode, e.Temp)
+		}
+	}
+}
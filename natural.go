@@ -0,0 +1,66 @@
+package renby
+
+import "strings"
+
+// naturalCompare compares strings in natural order: runs of digits are
+// compared by their numeric value, so "img2" sorts before "img10".
+// When ignoreCase is set, the other runs are compared case-insensitively.
+// It returns -1, 0 or +1 depending on the natural order of a and b.
+func naturalCompare(a, b string, ignoreCase bool) int {
+	if ignoreCase {
+		a, b = strings.ToLower(a), strings.ToLower(b)
+	}
+
+	for a != "" && b != "" {
+		ra, restA := nextRun(a)
+		rb, restB := nextRun(b)
+		a, b = restA, restB
+
+		if isDigit(ra[0]) && isDigit(rb[0]) {
+			if c := compareNumeric(ra, rb); c != 0 {
+				return c
+			}
+			continue
+		}
+		if c := strings.Compare(ra, rb); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// nextRun splits s into its leading run of digits or non-digits and the rest
+func nextRun(s string) (string, string) {
+	digit := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digit {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// compareNumeric compares digit runs by value, then by number of leading zeros
+func compareNumeric(a, b string) int {
+	ta := strings.TrimLeft(a, "0")
+	tb := strings.TrimLeft(b, "0")
+	if len(ta) != len(tb) {
+		if len(ta) < len(tb) {
+			return -1
+		}
+		return 1
+	}
+	if c := strings.Compare(ta, tb); c != 0 {
+		return c
+	}
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
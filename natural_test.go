@@ -0,0 +1,60 @@
+package renby
+
+import (
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestNaturalCompare(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      []string
+		ignoreCase bool
+		want       []string
+	}{
+		{
+			name:  "numbers by value",
+			input: []string{"scan10", "scan2", "scan120", "scan1"},
+			want:  []string{"scan1", "scan2", "scan10", "scan120"},
+		},
+		{
+			name:  "leading zeros",
+			input: []string{"img010", "img9", "img0010", "img10"},
+			want:  []string{"img9", "img10", "img010", "img0010"},
+		},
+		{
+			name:  "multiple numbers",
+			input: []string{"v1.10.txt", "v1.9.txt", "v10.1.txt", "v1.9a.txt"},
+			want:  []string{"v1.9.txt", "v1.9a.txt", "v1.10.txt", "v10.1.txt"},
+		},
+		{
+			name:  "case sensitive",
+			input: []string{"b1", "A2", "a1", "B2"},
+			want:  []string{"A2", "B2", "a1", "b1"},
+		},
+		{
+			name:       "ignore case",
+			input:      []string{"b1", "A2", "a1", "B2"},
+			ignoreCase: true,
+			want:       []string{"a1", "A2", "b1", "B2"},
+		},
+		{
+			name:  "prefix",
+			input: []string{"abc", "ab", "ab1"},
+			want:  []string{"ab", "ab1", "abc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := slices.Clone(tt.input)
+			sort.Slice(got, func(i, j int) bool {
+				return naturalCompare(got[i], got[j], tt.ignoreCase) < 0
+			})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("sorted = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
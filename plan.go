@@ -0,0 +1,422 @@
+package renby
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConflictKind represents the reason why a planned rename is unsafe
+type ConflictKind int
+
+const (
+	// ConflictDuplicateDestination means multiple sources map to the same destination
+	ConflictDuplicateDestination ConflictKind = iota
+	// ConflictDestinationExists means the destination exists and is not part of the batch
+	ConflictDestinationExists
+	// ConflictDestinationIsSource means the destination is a source renamed later in the batch
+	ConflictDestinationIsSource
+)
+
+// Conflict represents a problem detected while building a plan
+type Conflict struct {
+	Kind        ConflictKind
+	Destination string
+	Sources     []string
+}
+
+// String returns a human readable description of the conflict
+func (c Conflict) String() string {
+	switch c.Kind {
+	case ConflictDuplicateDestination:
+		return fmt.Sprintf("multiple sources %v -> same destination %q", c.Sources, c.Destination)
+	case ConflictDestinationExists:
+		return fmt.Sprintf("destination already exists: %q", c.Destination)
+	case ConflictDestinationIsSource:
+		return fmt.Sprintf("destination %q is also a source", c.Destination)
+	default:
+		return fmt.Sprintf("unknown conflict on %q", c.Destination)
+	}
+}
+
+// PlanEntry represents a single planned rename
+type PlanEntry struct {
+	Source      string
+	Destination string
+	Key         string // sort key value used to order the entry
+	Index       int    // position in the plan, groups follow each other
+	Info        FileInfo
+	Primary     string // source of the primary file when the entry is a sidecar
+	Conflicts   []Conflict
+}
+
+// Unchanged reports whether the entry keeps its current name
+func (e PlanEntry) Unchanged() bool {
+	return e.Source == e.Destination
+}
+
+// Plan represents an ordered, inspectable set of renames
+type Plan struct {
+	Entries   []PlanEntry
+	Conflicts []Conflict
+	Warnings  []string // e.g. sort timestamps substituted by fallbacks
+	opts      Options
+}
+
+// BuildPlan computes the renames for the given files without touching them
+func BuildPlan(files []string, opts Options) (*Plan, error) {
+	if err := (&opts).Validate(); err != nil {
+		return nil, fmt.Errorf("invalid options: %w", err)
+	}
+
+	fileInfos, err := collectFileInfo(files, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sortFiles(fileInfos, opts)
+
+	// with Sidecars, only primary files are numbered and their sidecars follow
+	units := fileInfos
+	var sidecars map[string][]FileInfo
+	if opts.Sidecars {
+		units, sidecars = splitSidecars(fileInfos, opts)
+	}
+
+	keys, groups := groupFiles(units, opts)
+	entries := make([]PlanEntry, 0, len(fileInfos))
+	for _, key := range keys {
+		group, counters, err := numberFiles(groups[key], sidecars, key, opts)
+		if err != nil {
+			return nil, err
+		}
+		cf := opts.counterFormat(slices.Max(append(counters, 0)))
+
+		for i, fi := range group {
+			dst := fi.Path
+			if counters[i] >= 0 {
+				dst, err = generateNewName(fi, counters[i], cf, opts)
+				if err != nil {
+					return nil, err
+				}
+			}
+			entries = append(entries, PlanEntry{
+				Source:      fi.Path,
+				Destination: dst,
+				Key:         sortKeyString(fi, opts),
+				Index:       len(entries),
+				Info:        fi,
+			})
+
+			for _, sc := range sidecars[fi.Path] {
+				scDst := sc.Path
+				if counters[i] >= 0 {
+					scDst, err = generateNewName(sidecarInfo(fi, sc), counters[i], cf, opts)
+					if err != nil {
+						return nil, err
+					}
+				}
+				entries = append(entries, PlanEntry{
+					Source:      sc.Path,
+					Destination: scDst,
+					Key:         sortKeyString(fi, opts),
+					Index:       len(entries),
+					Info:        sc,
+					Primary:     fi.Path,
+				})
+			}
+		}
+	}
+
+	plan := &Plan{Entries: entries, Warnings: fallbackWarnings(fileInfos, opts), opts: opts}
+	plan.detectConflicts()
+	return plan, nil
+}
+
+// HasConflicts reports whether the plan contains any conflict
+func (p *Plan) HasConflicts() bool {
+	return len(p.Conflicts) > 0
+}
+
+// Filter returns a new plan containing only the entries accepted by keep.
+// Conflicts are detected again for the remaining entries.
+func (p *Plan) Filter(keep func(PlanEntry) bool) *Plan {
+	filtered := &Plan{Warnings: p.Warnings, opts: p.opts}
+	for _, e := range p.Entries {
+		if keep(e) {
+			e.Conflicts = nil
+			filtered.Entries = append(filtered.Entries, e)
+		}
+	}
+	filtered.detectConflicts()
+	return filtered
+}
+
+// detectConflicts fills the plan and entry conflicts:
+// - Multiple sources mapping to the same destination
+// - Destination already exists on filesystem and is not one of the sources
+// - Destination is a source which has not been renamed yet at that point,
+// or any source when the mode leaves sources in place
+func (p *Plan) detectConflicts() {
+	p.Conflicts = nil
+	dstToIdx := make(map[string][]int, len(p.Entries))
+	srcToIdx := make(map[string]int, len(p.Entries))
+	for i, e := range p.Entries {
+		dstToIdx[e.Destination] = append(dstToIdx[e.Destination], i)
+		srcToIdx[e.Source] = i
+	}
+
+	addConflict := func(c Conflict, idx ...int) {
+		p.Conflicts = append(p.Conflicts, c)
+		for _, i := range idx {
+			p.Entries[i].Conflicts = append(p.Entries[i].Conflicts, c)
+		}
+	}
+
+	reported := make(map[string]struct{})
+	for i, e := range p.Entries {
+		if e.Unchanged() {
+			continue
+		}
+		if idx := dstToIdx[e.Destination]; len(idx) > 1 {
+			if _, ok := reported[e.Destination]; !ok {
+				reported[e.Destination] = struct{}{}
+				srcs := make([]string, len(idx))
+				for k, j := range idx {
+					srcs[k] = p.Entries[j].Source
+				}
+				addConflict(Conflict{Kind: ConflictDuplicateDestination, Destination: e.Destination, Sources: srcs}, idx...)
+			}
+		}
+		if j, isSource := srcToIdx[e.Destination]; isSource && p.opts.Mode == ModeMove {
+			if j > i {
+				addConflict(Conflict{Kind: ConflictDestinationIsSource, Destination: e.Destination, Sources: []string{e.Source}}, i)
+			}
+			continue
+		}
+		if _, err := os.Lstat(e.Destination); err == nil {
+			addConflict(Conflict{Kind: ConflictDestinationExists, Destination: e.Destination, Sources: []string{e.Source}}, i)
+		}
+	}
+}
+
+// conflictError returns the error reported when the plan cannot be applied
+func (p *Plan) conflictError() error {
+	msgs := make([]string, len(p.Conflicts))
+	for i, c := range p.Conflicts {
+		msgs[i] = c.String()
+	}
+	return fmt.Errorf("conflicts detected, aborting: %s", strings.Join(msgs, "; "))
+}
+
+// Apply executes the plan.
+// Without ForceOverwrite, any conflict aborts before a file is touched.
+// The batch is all-or-nothing: when any step fails, the steps already
+// taken are reversed and a *RollbackError is returned.
+func (p *Plan) Apply(ctx context.Context) (err error) {
+	if p.HasConflicts() && !p.opts.ForceOverwrite {
+		return p.conflictError()
+	}
+
+	if p.opts.OutDir != "" {
+		if err := os.MkdirAll(p.opts.OutDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	if p.opts.Mode == ModeHardlink {
+		if err := p.checkLinkable(); err != nil {
+			return err
+		}
+	}
+
+	exec := &executor{mode: p.opts.Mode, journal: newJournalWriter(p.opts.JournalDir)}
+	// an unusable journal fails the batch before a file is touched
+	if p.changesFiles() {
+		if err := exec.journal.open(); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		if cerr := exec.journal.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	if p.opts.ForceOverwrite {
+		err = p.applyTwoPhase(ctx, exec)
+	} else {
+		err = p.applyDirect(ctx, exec)
+	}
+	if err != nil {
+		return exec.rollback(err)
+	}
+	return exec.commit()
+}
+
+// changesFiles reports whether any entry of the plan changes its name
+func (p *Plan) changesFiles() bool {
+	for _, e := range p.Entries {
+		if !e.Unchanged() {
+			return true
+		}
+	}
+	return false
+}
+
+// applyDirect renames each source straight to its destination,
+// failing when any destination already exists.
+func (p *Plan) applyDirect(ctx context.Context, exec *executor) error {
+	srcSet := make(map[string]struct{}, len(p.Entries))
+	for _, e := range p.Entries {
+		srcSet[e.Source] = struct{}{}
+	}
+
+	for _, e := range p.Entries {
+		if e.Unchanged() {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := os.Lstat(e.Destination); err == nil {
+			if _, isSource := srcSet[e.Destination]; isSource {
+				return fmt.Errorf("conflicts detected: destination %q is also a source", e.Destination)
+			}
+			return fmt.Errorf("destination already exists before renaming: %q", e.Destination)
+		}
+		if err := exec.transfer(e.Source, e.Destination); err != nil {
+			return fmt.Errorf("failed to %s file: %w", p.opts.Mode, err)
+		}
+	}
+	return nil
+}
+
+// applyTwoPhase uses safe two-phase renaming to avoid overwrites/cycles:
+// 1) rename each src -> unique temp
+// 2) rename each temp -> final dst
+// The intent is logged next to the temps before phase one so that an
+// interrupted batch can be recovered.
+func (p *Plan) applyTwoPhase(ctx context.Context, exec *executor) error {
+	pid := os.Getpid()
+	intent := newIntentLog(pid)
+	intent.journal = exec.journal.path()
+	temps := make([]intentEntry, len(p.Entries))
+	counter := 0
+	for i, e := range p.Entries {
+		if e.Unchanged() {
+			continue
+		}
+		// recover may run from another working directory
+		src, err := filepath.Abs(e.Source)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %q: %w", e.Source, err)
+		}
+		dst, err := filepath.Abs(e.Destination)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %q: %w", e.Destination, err)
+		}
+		temps[i] = intentEntry{
+			Source:      src,
+			Temp:        tempName(dst, pid, &counter),
+			Backup:      tempName(dst, pid, &counter),
+			Destination: dst,
+		}
+		if p.opts.Mode != ModeMove {
+			temps[i].Op = p.opts.Mode.String()
+		}
+		intent.add(temps[i])
+	}
+	exec.intent = intent
+	if err := intent.write(intentPhase1); err != nil {
+		return err
+	}
+
+	for i, e := range p.Entries {
+		if e.Unchanged() {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := exec.transfer(e.Source, temps[i].Temp); err != nil {
+			return fmt.Errorf("failed to %s source %q to temp %q: %w", p.opts.Mode, e.Source, temps[i].Temp, err)
+		}
+	}
+
+	if err := intent.write(intentPhase2); err != nil {
+		return err
+	}
+
+	// move temps to final destinations
+	for i, e := range p.Entries {
+		if e.Unchanged() {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// ensure dst does not exist (moved aside, removed on commit)
+		if _, err := os.Lstat(e.Destination); err == nil {
+			if err := exec.moveAside(e.Destination, temps[i].Backup); err != nil {
+				return fmt.Errorf("failed to remove existing destination %q: %w", e.Destination, err)
+			}
+		}
+		if err := exec.rename(temps[i].Temp, e.Destination); err != nil {
+			return fmt.Errorf("failed to rename temp %q to dst %q: %w", temps[i].Temp, e.Destination, err)
+		}
+	}
+
+	return nil
+}
+
+// tempName builds a unique temp name in the same directory as dst
+func tempName(dst string, pid int, counter *int) string {
+	dir := filepath.Dir(dst)
+	ext := filepath.Ext(dst)
+	base := strings.TrimSuffix(filepath.Base(dst), ext)
+	for {
+		temp := filepath.Join(dir, fmt.Sprintf("%s.renby.tmp.%d.%d%s", base, pid, *counter, ext))
+		*counter++
+		if _, err := os.Lstat(temp); os.IsNotExist(err) {
+			return temp
+		}
+	}
+}
+
+// sortKeyString formats the values used to sort the file
+func sortKeyString(fi FileInfo, opts Options) string {
+	keys := opts.sortKeys()
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = sortValueString(fi, key.Mode, opts)
+	}
+	return strings.Join(values, ",")
+}
+
+// sortValueString formats the value of a single sort mode
+func sortValueString(fi FileInfo, mode SortMode, opts Options) string {
+	switch mode {
+	case SortByCreationTime:
+		return fi.CreateTime.Format(time.RFC3339Nano)
+	case SortByModificationTime:
+		return fi.ModTime.Format(time.RFC3339Nano)
+	case SortByAccessTime:
+		return fi.AccessTime.Format(time.RFC3339Nano)
+	case SortByChangeTime:
+		return fi.ChangeTime.Format(time.RFC3339Nano)
+	case SortByCaptureTime:
+		return fi.CaptureTime.Format(time.RFC3339Nano)
+	case SortBySize:
+		return strconv.FormatInt(fi.Size, 10)
+	case SortByName:
+		return nameKey(fi, opts)
+	default:
+		return fi.Path
+	}
+}
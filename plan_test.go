@@ -0,0 +1,101 @@
+package renby
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSizedFiles(t *testing.T, dir string, sizes map[string]int) []string {
+	t.Helper()
+	var files []string
+	for name, size := range sizes {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+func TestBuildPlan(t *testing.T) {
+	dir := t.TempDir()
+	files := writeSizedFiles(t, dir, map[string]int{"c.txt": 30, "a.txt": 10, "b.txt": 20})
+
+	plan, err := BuildPlan(files, Options{Pattern: "00", FileMode: SortBySize, Init: 1})
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+	if plan.HasConflicts() {
+		t.Fatalf("unexpected conflicts: %v", plan.Conflicts)
+	}
+
+	want := []struct{ src, dst, key string }{
+		{"a.txt", "01.txt", "10"},
+		{"b.txt", "02.txt", "20"},
+		{"c.txt", "03.txt", "30"},
+	}
+	if len(plan.Entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(plan.Entries), len(want))
+	}
+	for i, w := range want {
+		e := plan.Entries[i]
+		if filepath.Base(e.Source) != w.src || filepath.Base(e.Destination) != w.dst || e.Key != w.key || e.Index != i {
+			t.Errorf("entry[%d] = %s -> %s (key %s, index %d), want %s -> %s (key %s, index %d)",
+				i, filepath.Base(e.Source), filepath.Base(e.Destination), e.Key, e.Index, w.src, w.dst, w.key, i)
+		}
+	}
+
+	// Building a plan must not touch any file
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("source %s missing after BuildPlan: %v", f, err)
+		}
+	}
+
+	if err := plan.Apply(context.Background()); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	for _, w := range want {
+		if _, err := os.Stat(filepath.Join(dir, w.dst)); err != nil {
+			t.Errorf("destination %s missing after Apply: %v", w.dst, err)
+		}
+	}
+}
+
+func TestBuildPlan_Conflicts(t *testing.T) {
+	dir := t.TempDir()
+	files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20})
+	writeSizedFiles(t, dir, map[string]int{"2.txt": 1})
+
+	plan, err := BuildPlan(files, Options{Pattern: "0", FileMode: SortBySize, Init: 1})
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+	if len(plan.Conflicts) != 1 || plan.Conflicts[0].Kind != ConflictDestinationExists {
+		t.Fatalf("unexpected conflicts: %v", plan.Conflicts)
+	}
+	if len(plan.Entries[0].Conflicts) != 0 || len(plan.Entries[1].Conflicts) != 1 {
+		t.Errorf("conflicts attached to wrong entries: %v / %v", plan.Entries[0].Conflicts, plan.Entries[1].Conflicts)
+	}
+	if err := plan.Apply(context.Background()); err == nil {
+		t.Fatal("Apply() error = nil, want conflict error")
+	}
+
+	// Filtering out the conflicting entry makes the plan applicable
+	filtered := plan.Filter(func(e PlanEntry) bool { return len(e.Conflicts) == 0 })
+	if filtered.HasConflicts() || len(filtered.Entries) != 1 {
+		t.Fatalf("unexpected filtered plan: %+v", filtered)
+	}
+	if err := filtered.Apply(context.Background()); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "1.txt")); err != nil {
+		t.Errorf("1.txt missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt")); err != nil {
+		t.Errorf("b.txt should be untouched: %v", err)
+	}
+}
@@ -0,0 +1,383 @@
+package renby
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	intentPrefix  = ".renby.intent."
+	intentSuffix  = ".json"
+	intentFormat  = 1
+	intentPhase1  = 1 // sources are being moved to temps
+	intentPhase2  = 2 // temps are being moved to destinations
+	tempNameMatch = `\.renby\.(?:tmp\.\d+\.\d+|part\.\d+)`
+)
+
+var tempNameRegexp = regexp.MustCompile(tempNameMatch)
+
+// RecoverMode represents how an interrupted batch is recovered
+type RecoverMode int
+
+const (
+	// RecoverAuto completes batches interrupted in phase two, reverts the others
+	RecoverAuto RecoverMode = iota
+	// RecoverComplete finishes the interrupted batch
+	RecoverComplete
+	// RecoverRevert restores the original names of the interrupted batch
+	RecoverRevert
+)
+
+// RecoverReport summarizes a recovery
+type RecoverReport struct {
+	Completed int      // number of batches completed
+	Reverted  int      // number of batches reverted
+	Orphans   []string // temp files not covered by any intent log
+}
+
+// intentEntry represents a planned two-phase rename.
+// Backup is the name an existing destination is moved to during phase two.
+// Op is the mode name when the temp is created from the source, which
+// stays in place, and empty when the source is moved.
+type intentEntry struct {
+	Op          string `json:"op,omitempty"`
+	Source      string `json:"source"`
+	Temp        string `json:"temp"`
+	Backup      string `json:"backup"`
+	Destination string `json:"destination"`
+}
+
+// intentFile is the on-disk intent log of one directory.
+// Journal is the path of the undo journal of the batch, if any.
+type intentFile struct {
+	Version int           `json:"version"`
+	Phase   int           `json:"phase"`
+	Journal string        `json:"journal,omitempty"`
+	Entries []intentEntry `json:"entries"`
+}
+
+// intentLog writes the intent of a two-phase batch before phase one,
+// one file per directory holding temps, so that a crashed batch can be
+// recovered from the directory alone.
+type intentLog struct {
+	pid     int
+	journal string
+	dirs    []string
+	entries map[string][]intentEntry
+}
+
+func newIntentLog(pid int) *intentLog {
+	return &intentLog{pid: pid, entries: make(map[string][]intentEntry)}
+}
+
+// add registers a planned rename
+func (l *intentLog) add(e intentEntry) {
+	dir := filepath.Dir(e.Temp)
+	if _, ok := l.entries[dir]; !ok {
+		l.dirs = append(l.dirs, dir)
+	}
+	l.entries[dir] = append(l.entries[dir], e)
+}
+
+func (l *intentLog) path(dir string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%d%s", intentPrefix, l.pid, intentSuffix))
+}
+
+// write stores the intent with the given phase in every directory
+func (l *intentLog) write(phase int) error {
+	if l == nil {
+		return nil
+	}
+	for _, dir := range l.dirs {
+		data, err := json.Marshal(intentFile{Version: intentFormat, Phase: phase, Journal: l.journal, Entries: l.entries[dir]})
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(l.path(dir), data); err != nil {
+			return fmt.Errorf("failed to write intent log: %w", err)
+		}
+	}
+	return nil
+}
+
+// remove deletes the intent files once the batch is settled
+func (l *intentLog) remove() error {
+	if l == nil {
+		return nil
+	}
+	for _, dir := range l.dirs {
+		if err := os.Remove(l.path(dir)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove intent log: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data so that readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Recover finds batches interrupted in dir, using the intent logs written
+// before phase one, and either completes or reverts them. Temp files which
+// are not covered by any intent log are reported as orphans and left alone.
+func Recover(dir string, mode RecoverMode) (*RecoverReport, error) {
+	// intent logs hold absolute paths, see applyTwoPhase
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var intents []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, intentPrefix) && strings.HasSuffix(name, intentSuffix) {
+			intents = append(intents, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(intents)
+
+	report := &RecoverReport{}
+	known := make(map[string]struct{})
+	var errs []error
+	for _, path := range intents {
+		intent, err := readIntent(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, e := range intent.Entries {
+			known[e.Temp] = struct{}{}
+			known[e.Backup] = struct{}{}
+		}
+
+		complete := mode == RecoverComplete || (mode == RecoverAuto && intent.Phase == intentPhase2)
+		if complete {
+			err = intent.completeJournaled()
+		} else {
+			err = intent.revert()
+			if err == nil {
+				err = dropJournalSteps(intent.Journal, intent.Entries)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to recover %q: %w", path, err))
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove intent log: %w", err))
+			continue
+		}
+		if complete {
+			report.Completed++
+		} else {
+			report.Reverted++
+		}
+	}
+
+	// temps of recovered batches are gone, list what is left
+	entries, err = os.ReadDir(dir)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to read directory: %w", err))
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !tempNameRegexp.MatchString(entry.Name()) {
+			continue
+		}
+		if _, ok := known[path]; !ok {
+			report.Orphans = append(report.Orphans, path)
+		}
+	}
+
+	return report, errors.Join(errs...)
+}
+
+func readIntent(path string) (*intentFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read intent log: %w", err)
+	}
+	var intent intentFile
+	if err := json.Unmarshal(data, &intent); err != nil {
+		return nil, fmt.Errorf("invalid intent log %q: %w", path, err)
+	}
+	if intent.Version != intentFormat {
+		return nil, fmt.Errorf("unsupported intent log version %d in %q", intent.Version, path)
+	}
+	return &intent, nil
+}
+
+// completeJournaled completes the batch and rewrites its journal as if the
+// batch had not been interrupted, so that undo can still reverse it
+func (f *intentFile) completeJournaled() error {
+	if err := f.complete(); err != nil {
+		return err
+	}
+	return rewriteJournal(f.Journal, f.Entries)
+}
+
+// complete rolls the batch forward to its destinations
+func (f *intentFile) complete() error {
+	// Phase one was interrupted: sources still present have not been moved yet
+	if f.Phase == intentPhase1 {
+		for _, e := range f.Entries {
+			if e.Op != opRename {
+				// a temp may be incomplete, create it again from its source
+				if err := recreate(e); err != nil {
+					return err
+				}
+				continue
+			}
+			if exists(e.Temp) {
+				// a move across filesystems stopped before removing its source
+				if exists(e.Source) {
+					if err := removeDuplicate(e.Source, e.Temp); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if !exists(e.Source) {
+				return fmt.Errorf("neither source %q nor temp %q exists", e.Source, e.Temp)
+			}
+			if err := moveFile(e.Source, e.Temp); err != nil {
+				return err
+			}
+		}
+	}
+
+	// A missing temp means the entry already reached its destination
+	for _, e := range f.Entries {
+		if !exists(e.Temp) {
+			if !exists(e.Destination) {
+				return fmt.Errorf("neither temp %q nor destination %q exists", e.Temp, e.Destination)
+			}
+			continue
+		}
+		if exists(e.Destination) {
+			if err := os.Rename(e.Destination, e.Backup); err != nil {
+				return err
+			}
+		}
+		if err := os.Rename(e.Temp, e.Destination); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range f.Entries {
+		if err := os.Remove(e.Backup); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// revert moves every file of the batch back to its source
+func (f *intentFile) revert() error {
+	if f.Phase == intentPhase2 {
+		for i := len(f.Entries) - 1; i >= 0; i-- {
+			e := f.Entries[i]
+			if !exists(e.Temp) && exists(e.Destination) {
+				if err := os.Rename(e.Destination, e.Temp); err != nil {
+					return err
+				}
+			}
+			if exists(e.Backup) {
+				if err := os.Rename(e.Backup, e.Destination); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// A missing temp means the entry has not left its source, which a
+	// move must then still hold
+	for i := len(f.Entries) - 1; i >= 0; i-- {
+		e := f.Entries[i]
+		if !exists(e.Temp) {
+			if e.Op == opRename && !exists(e.Source) {
+				return fmt.Errorf("neither source %q nor temp %q exists", e.Source, e.Temp)
+			}
+			continue
+		}
+		if e.Op != opRename {
+			if err := os.Remove(e.Temp); err != nil {
+				return err
+			}
+			continue
+		}
+		if exists(e.Source) {
+			// a move across filesystems stopped before removing its source
+			if err := removeDuplicate(e.Temp, e.Source); err != nil {
+				return fmt.Errorf("cannot restore %q: source name is already in use", e.Temp)
+			}
+			continue
+		}
+		if err := moveFile(e.Temp, e.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeDuplicate removes path when it is an identical copy of kept
+func removeDuplicate(path, kept string) error {
+	same, err := sameContent(path, kept)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return fmt.Errorf("%q and %q both exist with different content", path, kept)
+	}
+	return os.Remove(path)
+}
+
+// recreate creates the temp of an entry which leaves its source in place
+func recreate(e intentEntry) error {
+	mode, err := ParseMode(e.Op)
+	if err != nil {
+		return err
+	}
+	if !exists(e.Source) {
+		return fmt.Errorf("source %q of temp %q does not exist", e.Source, e.Temp)
+	}
+	if err := os.Remove(e.Temp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return createFrom(mode, e.Source, e.Temp)
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
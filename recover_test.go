@@ -0,0 +1,325 @@
+package renby
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// crash is the panic stopping a batch in crashTwoPhase
+type crash struct{}
+
+// crashTwoPhase applies a two-phase batch for files and stops it, as a
+// killed process would, after the given number of phase one and phase two
+// renames. Nothing is rolled back and the intent log is left behind.
+func crashTwoPhase(t *testing.T, files []string, journalDir string, phase1, phase2 int) {
+	t.Helper()
+	plan, err := BuildPlan(files, Options{Pattern: "0", FileMode: SortBySize, Init: 1, ForceOverwrite: true, JournalDir: journalDir})
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+
+	limit := phase1
+	if phase1 >= len(plan.Entries) {
+		limit += phase2
+	}
+	renames := 0
+	osRename = func(from, to string) error {
+		if renames == limit {
+			panic(crash{})
+		}
+		renames++
+		return os.Rename(from, to)
+	}
+	defer func() {
+		osRename = os.Rename
+		switch r := recover(); r.(type) {
+		case crash:
+		case nil:
+			t.Fatal("batch was not interrupted")
+		default:
+			panic(r)
+		}
+	}()
+	plan.Apply(context.Background())
+}
+
+func TestRecover(t *testing.T) {
+	original := []string{"1.txt", "a.txt", "b.txt"}
+	renamed := []string{"1.txt", "2.txt", "3.txt"}
+
+	tests := []struct {
+		name          string
+		phase1        int
+		phase2        int
+		mode          RecoverMode
+		want          []string
+		wantCompleted int
+		wantReverted  int
+	}{
+		{name: "auto reverts phase one", phase1: 1, mode: RecoverAuto, want: original, wantReverted: 1},
+		{name: "auto completes phase two", phase1: 3, phase2: 1, mode: RecoverAuto, want: renamed, wantCompleted: 1},
+		{name: "complete phase one", phase1: 2, mode: RecoverComplete, want: renamed, wantCompleted: 1},
+		{name: "revert phase two", phase1: 3, phase2: 2, mode: RecoverRevert, want: original, wantReverted: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			// 1.txt is the largest file and gets renamed to 3.txt, so its
+			// own name is reused by a.txt
+			files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20, "1.txt": 30})
+			crashTwoPhase(t, files, "", tt.phase1, tt.phase2)
+
+			report, err := Recover(dir, tt.mode)
+			if err != nil {
+				t.Fatalf("Recover() error = %v", err)
+			}
+			if report.Completed != tt.wantCompleted || report.Reverted != tt.wantReverted || len(report.Orphans) != 0 {
+				t.Errorf("Recover() report = %+v", report)
+			}
+			if got := listNames(t, dir); !slices.Equal(got, tt.want) {
+				t.Errorf("names after recover = %v, want %v", got, tt.want)
+			}
+
+			sizes := map[string]int64{"a.txt": 10, "b.txt": 20, "1.txt": 30}
+			if slices.Equal(tt.want, renamed) {
+				sizes = map[string]int64{"1.txt": 10, "2.txt": 20, "3.txt": 30}
+			}
+			for name, size := range sizes {
+				if info, err := os.Stat(filepath.Join(dir, name)); err != nil || info.Size() != size {
+					t.Errorf("%s has wrong content after recover: %v, %v", name, info, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRecover_RelativeDir(t *testing.T) {
+	dir := t.TempDir()
+	files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20})
+	crashTwoPhase(t, files, "", 1, 0)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	report, err := Recover(".", RecoverAuto)
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if report.Reverted != 1 || len(report.Orphans) != 0 {
+		t.Errorf("Recover() report = %+v, want one reverted batch and no orphans", report)
+	}
+	if got, want := listNames(t, dir), []string{"a.txt", "b.txt"}; !slices.Equal(got, want) {
+		t.Errorf("names after recover = %v, want %v", got, want)
+	}
+}
+
+func TestRecover_RelativePaths(t *testing.T) {
+	for _, mode := range []RecoverMode{RecoverRevert, RecoverComplete} {
+		dir := t.TempDir()
+		journalDir := t.TempDir()
+		writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20, "1.txt": 30})
+
+		// the batch runs in dir, recover and undo run elsewhere
+		wd, err := os.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+		crashTwoPhase(t, []string{"a.txt", "b.txt", "1.txt"}, journalDir, 3, 1)
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Recover(dir, mode); err != nil {
+			t.Fatalf("mode %v: Recover() error = %v", mode, err)
+		}
+		if mode == RecoverComplete {
+			if got, want := listNames(t, dir), []string{"1.txt", "2.txt", "3.txt"}; !slices.Equal(got, want) {
+				t.Fatalf("names after complete = %v, want %v", got, want)
+			}
+			path, err := LatestJournal(journalDir)
+			if err != nil {
+				t.Fatalf("LatestJournal() error = %v", err)
+			}
+			if err := Undo(path); err != nil {
+				t.Fatalf("Undo() error = %v", err)
+			}
+		}
+		if got, want := listNames(t, dir), []string{"1.txt", "a.txt", "b.txt"}; !slices.Equal(got, want) {
+			t.Errorf("mode %v: names = %v, want %v", mode, got, want)
+		}
+	}
+}
+
+func TestRecover_MissingFile(t *testing.T) {
+	for _, mode := range []RecoverMode{RecoverRevert, RecoverComplete} {
+		dir := t.TempDir()
+		files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20})
+		crashTwoPhase(t, files, "", 2, 1)
+		// the temp of b.txt is gone from every name the intent log knows
+		temps, err := filepath.Glob(filepath.Join(dir, "*.renby.tmp.*"))
+		if err != nil || len(temps) != 1 {
+			t.Fatalf("temps = %v, %v, want one", temps, err)
+		}
+		if err := os.Rename(temps[0], filepath.Join(dir, "elsewhere.txt")); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Recover(dir, mode); err == nil {
+			t.Errorf("mode %v: Recover() error = nil, want error", mode)
+		}
+		if matches, _ := filepath.Glob(filepath.Join(dir, intentPrefix+"*")); len(matches) == 0 {
+			t.Errorf("mode %v: intent log removed after a failed recovery", mode)
+		}
+	}
+}
+
+func TestRecover_Orphans(t *testing.T) {
+	dir := t.TempDir()
+	orphan := filepath.Join(dir, "1.renby.tmp.123.0.txt")
+	if err := os.WriteFile(orphan, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Recover(dir, RecoverAuto)
+	if err != nil {
+		t.Fatalf("Recover() error = %v", err)
+	}
+	if !slices.Equal(report.Orphans, []string{orphan}) {
+		t.Errorf("Recover() orphans = %v, want %v", report.Orphans, []string{orphan})
+	}
+	if !exists(orphan) {
+		t.Error("orphan must be left alone")
+	}
+}
+
+func TestApply_RemovesIntentLog(t *testing.T) {
+	dir := t.TempDir()
+	files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20})
+
+	opts := Options{Pattern: "0", FileMode: SortBySize, Init: 1, ForceOverwrite: true}
+	if err := RenameFiles(files, opts); err != nil {
+		t.Fatalf("RenameFiles() error = %v", err)
+	}
+	if got, want := listNames(t, dir), []string{"1.txt", "2.txt"}; !slices.Equal(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+}
+
+func TestRecover_Journal(t *testing.T) {
+	t.Run("revert skips the journal", func(t *testing.T) {
+		journalDir := t.TempDir()
+		earlier := t.TempDir()
+		if err := RenameFiles(writeSizedFiles(t, earlier, map[string]int{"x.txt": 10}), Options{Pattern: "0", FileMode: SortBySize, Init: 1, JournalDir: journalDir}); err != nil {
+			t.Fatal(err)
+		}
+		want, err := LatestJournal(journalDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := t.TempDir()
+		crashTwoPhase(t, writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20}), journalDir, 1, 0)
+		if _, err := Recover(dir, RecoverRevert); err != nil {
+			t.Fatalf("Recover() error = %v", err)
+		}
+		if got, err := LatestJournal(journalDir); err != nil || got != want {
+			t.Errorf("LatestJournal() = %q, %v, want the earlier batch %q", got, err, want)
+		}
+	})
+
+	t.Run("complete can be undone", func(t *testing.T) {
+		journalDir := t.TempDir()
+		dir := t.TempDir()
+		crashTwoPhase(t, writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20, "c.txt": 30}), journalDir, 3, 1)
+		if _, err := Recover(dir, RecoverComplete); err != nil {
+			t.Fatalf("Recover() error = %v", err)
+		}
+		if got, want := listNames(t, dir), []string{"1.txt", "2.txt", "3.txt"}; !slices.Equal(got, want) {
+			t.Fatalf("names after recover = %v, want %v", got, want)
+		}
+
+		path, err := LatestJournal(journalDir)
+		if err != nil {
+			t.Fatalf("LatestJournal() error = %v", err)
+		}
+		if err := Undo(path); err != nil {
+			t.Fatalf("Undo() error = %v", err)
+		}
+		if got, want := listNames(t, dir), []string{"a.txt", "b.txt", "c.txt"}; !slices.Equal(got, want) {
+			t.Errorf("names after undo = %v, want %v", got, want)
+		}
+	})
+	t.Run("directories share the journal", func(t *testing.T) {
+		journalDir := t.TempDir()
+		reverted, completed := t.TempDir(), t.TempDir()
+		files := append(writeSizedFiles(t, reverted, map[string]int{"a.txt": 10}), writeSizedFiles(t, completed, map[string]int{"b.txt": 20})...)
+		crashTwoPhase(t, files, journalDir, 2, 1)
+
+		if _, err := Recover(reverted, RecoverRevert); err != nil {
+			t.Fatalf("Recover() revert error = %v", err)
+		}
+		if _, err := Recover(completed, RecoverComplete); err != nil {
+			t.Fatalf("Recover() complete error = %v", err)
+		}
+		if got, want := listNames(t, completed), []string{"2.txt"}; !slices.Equal(got, want) {
+			t.Fatalf("names after complete = %v, want %v", got, want)
+		}
+
+		// only the completed directory is left for undo
+		path, err := LatestJournal(journalDir)
+		if err != nil {
+			t.Fatalf("LatestJournal() error = %v", err)
+		}
+		if err := Undo(path); err != nil {
+			t.Fatalf("Undo() error = %v", err)
+		}
+		if got, want := listNames(t, completed), []string{"b.txt"}; !slices.Equal(got, want) {
+			t.Errorf("names after undo = %v, want %v", got, want)
+		}
+		if got, want := listNames(t, reverted), []string{"a.txt"}; !slices.Equal(got, want) {
+			t.Errorf("names of the reverted directory = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("completing brings back a fully reverted journal", func(t *testing.T) {
+		journalDir := t.TempDir()
+		reverted, completed := t.TempDir(), t.TempDir()
+		files := append(writeSizedFiles(t, reverted, map[string]int{"a.txt": 10}), writeSizedFiles(t, completed, map[string]int{"b.txt": 20})...)
+		// b.txt has not left its name yet, its directory adds no step
+		crashTwoPhase(t, files, journalDir, 1, 0)
+
+		if _, err := Recover(reverted, RecoverRevert); err != nil {
+			t.Fatalf("Recover() revert error = %v", err)
+		}
+		if _, err := LatestJournal(journalDir); !errors.Is(err, ErrNoJournal) {
+			t.Fatalf("LatestJournal() error = %v, want ErrNoJournal", err)
+		}
+		if _, err := Recover(completed, RecoverComplete); err != nil {
+			t.Fatalf("Recover() complete error = %v", err)
+		}
+		path, err := LatestJournal(journalDir)
+		if err != nil {
+			t.Fatalf("LatestJournal() error = %v", err)
+		}
+		if err := Undo(path); err != nil {
+			t.Fatalf("Undo() error = %v", err)
+		}
+		if got, want := listNames(t, completed), []string{"b.txt"}; !slices.Equal(got, want) {
+			t.Errorf("names after undo = %v, want %v", got, want)
+		}
+	})
+}
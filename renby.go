@@ -1,13 +1,18 @@
 package renby
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/hidez8891/go-renby/internal/exif"
 	"github.com/hidez8891/go-renby/internal/ostime"
 )
 
@@ -19,36 +24,169 @@ const (
 	SortByModificationTime
 	SortByAccessTime
 	SortBySize
+	SortByName
+	SortByChangeTime
+	SortByCaptureTime
+)
+
+// sortModeNames maps sort mode names used on the command line to modes
+var sortModeNames = map[string]SortMode{
+	"ctime":  SortByCreationTime,
+	"mtime":  SortByModificationTime,
+	"atime":  SortByAccessTime,
+	"size":   SortBySize,
+	"name":   SortByName,
+	"chtime": SortByChangeTime,
+	"exif":   SortByCaptureTime,
+}
+
+// ParseSortMode returns the sort mode for a name such as "mtime"
+func ParseSortMode(name string) (SortMode, error) {
+	mode, ok := sortModeNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown sort key '%s'", name)
+	}
+	return mode, nil
+}
+
+// SortKey represents a single sort criterion
+type SortKey struct {
+	Mode SortMode
+	Desc bool
+}
+
+// ParseSortKeys parses a comma separated list of sort keys such as
+// "mtime,-size,name". A leading '-' sorts the key in descending order.
+func ParseSortKeys(list string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		key := SortKey{}
+		if strings.HasPrefix(field, "-") {
+			key.Desc = true
+			field = field[1:]
+		} else {
+			field = strings.TrimPrefix(field, "+")
+		}
+		mode, err := ParseSortMode(field)
+		if err != nil {
+			return nil, err
+		}
+		key.Mode = mode
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// TimeField identifies a timestamp of FileInfo
+type TimeField uint8
+
+const (
+	CreateTimeField TimeField = 1 << iota
+	ChangeTimeField
+	ModTimeField
+	AccessTimeField
+	CaptureTimeField
 )
 
 // FileInfo represents file information used for sorting
 type FileInfo struct {
 	Path       string
 	Size       int64
-	CreateTime time.Time
+	CreateTime time.Time // birth time
+	ChangeTime time.Time // inode change time
 	ModTime    time.Time
 	AccessTime time.Time
+	// EXIF DateTimeOriginal, only read when sorting by SortByCaptureTime
+	CaptureTime time.Time
+	Genuine     TimeField // timestamps read from the filesystem, the others are fallbacks
+}
+
+// IsGenuine reports whether the timestamp f was read from the filesystem
+// rather than substituted by the fallback chain birth -> change -> modification time.
+func (fi FileInfo) IsGenuine(f TimeField) bool {
+	return fi.Genuine&f != 0
 }
 
 // Options represents configuration options for file renaming
 type Options struct {
-	Pre            string
-	Post           string
-	Pattern        string
+	Pre      string
+	Post     string
+	Pattern  string
+	Template string // e.g. "{n:04}_{name}{ext}", replaces Pre/Pattern/Post when set
+	// Counter formats every counter when set, overriding the style
+	// selected by the Pattern characters or the template
+	Counter    CounterFormatter
+	Step       int  // counter increment, 1 when zero
+	Descending bool // count down from Init by Step instead of up
+	AutoWidth  bool // pad counters to the width of the largest counter
+	// Append keeps files whose names already conform to the template and
+	// numbers the others after the highest counter found in their directories
+	Append bool
+	// SkipConforming keeps files whose names already conform to the template
+	// and gives the others the lowest counters not in use, so reruns are no-ops
+	SkipConforming bool
+	// CloseGaps renumbers conforming files in the order of their counters so
+	// that the sequence has no gaps, followed by the other files
+	CloseGaps bool
+	// Group numbers each group of files with its own sequence when set,
+	// e.g. GroupByDir; groups sharing a directory may produce conflicts
+	Group GroupFunc
+	// Sidecars treats files sharing a directory and a stem as one unit:
+	// sorted by and numbered with the primary file, each member keeping its
+	// extension. PrimaryExts ranks the primary, DefaultPrimaryExts when empty.
+	Sidecars    bool
+	PrimaryExts []string
+	// OutDir receives every destination instead of the directory of its
+	// source; it is created when the plan is applied
+	OutDir string
+	// Mode selects whether sources are moved (the default), or copied or
+	// linked to their destinations, leaving the originals untouched
+	Mode           Mode
 	Reverse        bool
 	FileMode       SortMode
-	Init           int // default: 1
+	SortKeys       []SortKey // overrides FileMode when set
+	Init           int       // default: 1
 	ForceOverwrite bool
+	IgnoreCase     bool   // SortByName: compare names case-insensitively
+	FullPath       bool   // SortByName: compare full paths instead of base names
+	JournalDir     string // records completed renames for Undo when set
+	// SortByCaptureTime: use ModTime for files without EXIF instead of failing
+	CaptureTimeFallback bool
+
+	tmpl *template // parsed by Validate
 }
 
-// Validate checks if the options are valid
+// Validate checks if the options are valid and parses the naming template
 func (o *Options) Validate() error {
-	if o.Pattern == "" {
-		return fmt.Errorf("pattern cannot be empty")
+	if o.Template != "" {
+		if o.Pre != "" || o.Post != "" {
+			return fmt.Errorf("prefix and postfix cannot be combined with a template")
+		}
+		tmpl, err := parseTemplate(o.Template)
+		if err != nil {
+			return err
+		}
+		tmpl.bindSortTime(o.SortTime())
+		o.tmpl = tmpl
+	} else {
+		if o.Pattern == "" {
+			return fmt.Errorf("pattern cannot be empty")
+		}
+		o.tmpl = legacyTemplate(o.Pre, o.Pattern, o.Post)
 	}
 	if o.Init < 0 {
 		return fmt.Errorf("init value must be non-negative")
 	}
+	if o.Step < 0 {
+		return fmt.Errorf("step must be positive")
+	}
+	if o.keepsConforming() && o.Descending {
+		return fmt.Errorf("keeping conforming names cannot be combined with descending numbering")
+	}
+	if !o.Mode.valid() {
+		return fmt.Errorf("unknown mode %v", o.Mode)
+	}
 	return nil
 }
 
@@ -70,193 +208,255 @@ func getFileInfo(path string) (FileInfo, error) {
 	}
 
 	// Get system-specific file times
-	ostime := ostime.GetOsTime(info)
+	ostime, err := ostime.GetOsTime(path, info)
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("failed to get file times: %w", err)
+	}
 	fi.CreateTime = ostime.CreationTime
+	fi.ChangeTime = ostime.ChangeTime
 	fi.ModTime = ostime.ModificationTime
 	fi.AccessTime = ostime.AccessTime
+	fi.Genuine = genuineFields(ostime)
 
 	return fi, nil
 }
 
 // collectFileInfo gathers FileInfo for all input files
-func collectFileInfo(files []string) ([]FileInfo, error) {
+func collectFileInfo(files []string, opts Options) ([]FileInfo, error) {
 	if len(files) == 0 {
 		return nil, nil
 	}
 
+	needCapture := opts.usesSortMode(SortByCaptureTime) || opts.tmpl.uses(SortByCaptureTime)
 	fileInfos := make([]FileInfo, 0, len(files))
 	for _, file := range files {
 		fi, err := getFileInfo(file)
 		if err != nil {
 			return nil, err
 		}
-		if fi != (FileInfo{}) { // Skip empty FileInfo (directories)
-			fileInfos = append(fileInfos, fi)
+		if fi == (FileInfo{}) { // Skip empty FileInfo (directories)
+			continue
 		}
+		if needCapture {
+			if err := readCaptureTime(&fi, opts); err != nil {
+				return nil, err
+			}
+		}
+		fileInfos = append(fileInfos, fi)
 	}
 	return fileInfos, nil
 }
 
-// sortFiles sorts FileInfo slice based on the specified mode
-func sortFiles(files []FileInfo, mode SortMode, reverse bool) {
-	sort.Slice(files, func(i, j int) bool {
-		result := compareFiles(files[i], files[j], mode)
-		if reverse {
-			return !result
+// readCaptureTime fills the EXIF capture time of fi,
+// falling back to the modification time when allowed
+func readCaptureTime(fi *FileInfo, opts Options) error {
+	t, err := exif.ReadCaptureTime(fi.Path)
+	switch {
+	case err == nil:
+		fi.CaptureTime = t
+		fi.Genuine |= CaptureTimeField
+	case opts.CaptureTimeFallback && !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, fs.ErrPermission):
+		fi.CaptureTime = fi.ModTime
+	default:
+		return fmt.Errorf("failed to read EXIF capture time of %q: %w", fi.Path, err)
+	}
+	return nil
+}
+
+// usesSortMode reports whether any sort key in effect uses mode
+func (o *Options) usesSortMode(mode SortMode) bool {
+	for _, key := range o.sortKeys() {
+		if key.Mode == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// sortKeys returns the sort keys in effect
+func (o *Options) sortKeys() []SortKey {
+	if len(o.SortKeys) > 0 {
+		return o.SortKeys
+	}
+	return []SortKey{{Mode: o.FileMode}}
+}
+
+// genuineFields converts the genuine flags of ostime to TimeField
+func genuineFields(t ostime.OsTime) TimeField {
+	var f TimeField
+	if t.IsGenuine(ostime.Creation) {
+		f |= CreateTimeField
+	}
+	if t.IsGenuine(ostime.Change) {
+		f |= ChangeTimeField
+	}
+	if t.IsGenuine(ostime.Modification) {
+		f |= ModTimeField
+	}
+	if t.IsGenuine(ostime.Access) {
+		f |= AccessTimeField
+	}
+	return f
+}
+
+// sortTimeFields maps time sort modes to the timestamp they compare
+var sortTimeFields = map[SortMode]struct {
+	field    TimeField
+	name     string
+	fallback string
+}{
+	SortByCreationTime:     {CreateTimeField, "creation (birth) time", "inode change or modification time"},
+	SortByChangeTime:       {ChangeTimeField, "inode change time", "modification time"},
+	SortByModificationTime: {ModTimeField, "modification time", ""},
+	SortByAccessTime:       {AccessTimeField, "access time", "modification time"},
+	SortByCaptureTime:      {CaptureTimeField, "EXIF capture time", "modification time"},
+}
+
+// fallbackWarnings reports sort keys which use fallback timestamps
+func fallbackWarnings(files []FileInfo, opts Options) []string {
+	var warnings []string
+	for _, key := range opts.sortKeys() {
+		tf, ok := sortTimeFields[key.Mode]
+		if !ok {
+			continue
 		}
-		return result
+		var missing []string
+		for _, fi := range files {
+			if !fi.IsGenuine(tf.field) {
+				missing = append(missing, fi.Path)
+			}
+		}
+		if len(missing) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s is not available for %d file(s) (e.g. %q); using %s instead", tf.name, len(missing), missing[0], tf.fallback))
+		}
+	}
+	return warnings
+}
+
+// sortFiles sorts FileInfo slice by the sort keys, breaking ties by path
+// so that the order is deterministic. Reverse inverts the whole order.
+func sortFiles(files []FileInfo, opts Options) {
+	keys := opts.sortKeys()
+	sort.SliceStable(files, func(i, j int) bool {
+		result := 0
+		for _, key := range keys {
+			result = compareFiles(files[i], files[j], key.Mode, opts)
+			if key.Desc {
+				result = -result
+			}
+			if result != 0 {
+				break
+			}
+		}
+		if result == 0 {
+			result = strings.Compare(files[i].Path, files[j].Path)
+		}
+		if opts.Reverse {
+			return result > 0
+		}
+		return result < 0
 	})
 }
 
 // compareFiles compares two files based on the sort mode
-func compareFiles(a, b FileInfo, mode SortMode) bool {
+func compareFiles(a, b FileInfo, mode SortMode, opts Options) int {
 	switch mode {
 	case SortByCreationTime:
-		return a.CreateTime.Before(b.CreateTime)
+		return a.CreateTime.Compare(b.CreateTime)
 	case SortByModificationTime:
-		return a.ModTime.Before(b.ModTime)
+		return a.ModTime.Compare(b.ModTime)
 	case SortByAccessTime:
-		return a.AccessTime.Before(b.AccessTime)
+		return a.AccessTime.Compare(b.AccessTime)
+	case SortByChangeTime:
+		return a.ChangeTime.Compare(b.ChangeTime)
+	case SortByCaptureTime:
+		return a.CaptureTime.Compare(b.CaptureTime)
 	case SortBySize:
-		return a.Size < b.Size
+		return cmp.Compare(a.Size, b.Size)
+	case SortByName:
+		return naturalCompare(nameKey(a, opts), nameKey(b, opts), opts.IgnoreCase)
 	default:
-		return a.Path < b.Path
+		return strings.Compare(a.Path, b.Path)
 	}
 }
 
-// generateNewName creates a new filename based on the pattern
-func generateNewName(fi FileInfo, index int, opts Options) string {
-	ext := filepath.Ext(fi.Path)
-	basePath := fi.Path[:len(fi.Path)-len(ext)]
-	dir := filepath.Dir(basePath)
-
-	var newName string
-	if strings.Contains(opts.Pattern, "x") {
-		newName = fmt.Sprintf("%s%0*x%s%s", opts.Pre, len(opts.Pattern), index+opts.Init, opts.Post, ext)
-	} else {
-		newName = fmt.Sprintf("%s%0*d%s%s", opts.Pre, len(opts.Pattern), index+opts.Init, opts.Post, ext)
+// nameKey returns the name compared by SortByName
+func nameKey(fi FileInfo, opts Options) string {
+	if opts.FullPath {
+		return fi.Path
 	}
+	return filepath.Base(fi.Path)
+}
 
-	return filepath.Join(dir, newName)
+// keepsConforming reports whether names conforming to the template are recognised
+func (o *Options) keepsConforming() bool {
+	return o.Append || o.SkipConforming || o.CloseGaps
 }
 
-// RenameFiles renames files according to the specified options
-func RenameFiles(files []string, opts Options) error {
-	if err := (&opts).Validate(); err != nil {
-		return fmt.Errorf("invalid options: %w", err)
+// SortTime returns the timestamp of the first time sort key in effect,
+// SortByModificationTime when the files are not sorted by a timestamp.
+// It is the timestamp of the {time} placeholder.
+func (o Options) SortTime() SortMode {
+	for _, key := range o.sortKeys() {
+		if _, ok := sortTimeFields[key.Mode]; ok {
+			return key.Mode
+		}
 	}
+	return SortByModificationTime
+}
 
-	fileInfos, err := collectFileInfo(files)
-	if err != nil {
-		return err
+// step returns the counter increment in effect
+func (o *Options) step() int {
+	if o.Step == 0 {
+		return 1
 	}
+	return o.Step
+}
 
-	if len(fileInfos) == 0 {
-		return nil
+// counters returns the counters of n files in sorted order beginning at start
+func (o *Options) counters(start, n int) ([]int, error) {
+	step := o.step()
+	if o.Descending {
+		step = -step
 	}
 
-	sortFiles(fileInfos, opts.FileMode, opts.Reverse)
-
-	// Build planned mapping: src -> dst
-	plan := make(map[string]string, len(fileInfos))
-	dstToSrc := make(map[string][]string)
-	srcSet := make(map[string]struct{}, len(fileInfos))
-	for i, fi := range fileInfos {
-		dst := generateNewName(fi, i, opts)
-		plan[fi.Path] = dst
-		dstToSrc[dst] = append(dstToSrc[dst], fi.Path)
-		srcSet[fi.Path] = struct{}{}
+	counters := make([]int, n)
+	for i := range counters {
+		counters[i] = start + i*step
 	}
-
-	// Detect conflicts:
-	// - Multiple sources mapping to the same destination
-	// - Destination already exists on filesystem and is not one of the sources
-	var conflicts []string
-	for dst, srcs := range dstToSrc {
-		if len(srcs) > 1 {
-			conflicts = append(conflicts, fmt.Sprintf("multiple sources %v -> same destination %q", srcs, dst))
-		}
-		if _, ok := srcSet[dst]; !ok {
-			if _, err := os.Stat(dst); err == nil {
-				conflicts = append(conflicts, fmt.Sprintf("destination already exists: %q", dst))
-			}
-		}
+	if n > 0 && counters[n-1] < 0 {
+		return nil, fmt.Errorf("counting down from %d by %d goes below zero for %d files", start, -step, n)
 	}
+	return counters, nil
+}
 
-	if len(conflicts) > 0 && !opts.ForceOverwrite {
-		return fmt.Errorf("conflicts detected, aborting: %s", strings.Join(conflicts, "; "))
-	}
+// counterFormat returns how counters are formatted when largest is the largest counter
+func (o *Options) counterFormat(largest int) counterFormat {
+	return counterFormat{formatter: o.Counter, autoWidth: o.AutoWidth, largest: largest}
+}
 
-	// Perform renames.
-	// If not ForceOverwrite, fail renames when any destination already exists.
-	// If the existing destination is itself one of the sources in this batch,
-	// report it as a conflict so callers receive "conflicts detected".
-	if !opts.ForceOverwrite {
-		for src, dst := range plan {
-			if src == dst {
-				continue
-			}
-			if _, err := os.Stat(dst); err == nil {
-				if _, isSource := srcSet[dst]; isSource {
-					return fmt.Errorf("conflicts detected: destination %q is also a source", dst)
-				}
-				return fmt.Errorf("destination already exists before renaming: %q", dst)
-			}
-			if err := os.Rename(src, dst); err != nil {
-				return fmt.Errorf("failed to rename file: %w", err)
-			}
-		}
-		return nil
+// generateNewName creates a new filename based on the validated template
+func generateNewName(fi FileInfo, counter int, cf counterFormat, opts Options) (string, error) {
+	name, err := opts.tmpl.execute(fi, counter, cf)
+	if err != nil {
+		return "", fmt.Errorf("failed to name %q: %w", fi.Path, err)
 	}
+	return filepath.Join(opts.destDir(fi.Path), name), nil
+}
 
-	// Force mode: use safe two-phase renaming to avoid overwrites/cycles:
-	// 1) rename each src -> unique temp
-	// 2) rename each temp -> final dst
-	pid := os.Getpid()
-	temps := make(map[string]string, len(plan)) // src -> temp
-	counter := 0
-	for src, dst := range plan {
-		if src == dst {
-			continue
-		}
-		// build a unique temp name in same dir as dst
-		dir := filepath.Dir(dst)
-		ext := filepath.Ext(dst)
-		base := strings.TrimSuffix(filepath.Base(dst), ext)
-		var temp string
-		for {
-			temp = filepath.Join(dir, fmt.Sprintf("%s.renby.tmp.%d.%d%s", base, pid, counter, ext))
-			counter++
-			if _, err := os.Stat(temp); os.IsNotExist(err) {
-				break
-			}
-		}
-		if err := os.Rename(src, temp); err != nil {
-			return fmt.Errorf("failed to move source %q to temp %q: %w", src, temp, err)
-		}
-		temps[src] = temp
+// destDir returns the directory the file at path is named into
+func (o *Options) destDir(path string) string {
+	if o.OutDir != "" {
+		return o.OutDir
 	}
+	return filepath.Dir(path)
+}
 
-	// move temps to final destinations
-	for src, dst := range plan {
-		if src == dst {
-			continue
-		}
-		temp := temps[src]
-		if temp == "" {
-			// shouldn't happen
-			return fmt.Errorf("missing temp for source %q", src)
-		}
-		// ensure dst does not exist (remove if present)
-		if _, err := os.Stat(dst); err == nil {
-			if err := os.Remove(dst); err != nil {
-				return fmt.Errorf("failed to remove existing destination %q: %w", dst, err)
-			}
-		}
-		if err := os.Rename(temp, dst); err != nil {
-			return fmt.Errorf("failed to rename temp %q to dst %q: %w", temp, dst, err)
-		}
+// RenameFiles renames files according to the specified options
+func RenameFiles(files []string, opts Options) error {
+	plan, err := BuildPlan(files, opts)
+	if err != nil {
+		return err
 	}
-
-	return nil
+	return plan.Apply(context.Background())
 }
@@ -1,6 +1,7 @@
 package renby
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math/rand"
 	"os"
@@ -107,6 +108,16 @@ func TestRenameFiles(t *testing.T) {
 			},
 			results: generateResultNames("%03d.txt", testN),
 		},
+		{
+			name: "sort by change time asc",
+			opts: Options{
+				Pattern:  "000",
+				FileMode: SortByChangeTime,
+				Reverse:  false,
+				Init:     1,
+			},
+			results: generateResultNames("%03d.txt", testN),
+		},
 		{
 			name: "sort by size asc",
 			opts: Options{
@@ -221,6 +232,12 @@ func TestRenameFiles(t *testing.T) {
 					info2, _ := getFileInfo(filepath.Join(tempDir, preentries[j].Name()))
 					return info1.AccessTime.Before(info2.AccessTime)
 				})
+			case SortByChangeTime:
+				sort.Slice(preentries, func(i, j int) bool {
+					info1, _ := getFileInfo(filepath.Join(tempDir, preentries[i].Name()))
+					info2, _ := getFileInfo(filepath.Join(tempDir, preentries[j].Name()))
+					return info1.ChangeTime.Before(info2.ChangeTime)
+				})
 			case SortBySize:
 				sort.Slice(preentries, func(i, j int) bool {
 					info1, _ := getFileInfo(filepath.Join(tempDir, preentries[i].Name()))
@@ -369,3 +386,216 @@ func TestRenameFiles_CollisionDetected(t *testing.T) {
 		t.Fatalf("expected 2 files after force rename, got %d", len(final))
 	}
 }
+
+func TestRenameFiles_SortByName(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"scan10.png", "Scan2.png", "scan1.png", "scan120.png", "scan3.png"}
+	for i, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte{byte(i)}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := make([]string, len(names))
+	for i, name := range names {
+		files[i] = filepath.Join(dir, name)
+	}
+
+	opts := Options{
+		Pattern:    "000",
+		FileMode:   SortByName,
+		IgnoreCase: true,
+		Init:       1,
+	}
+	if err := RenameFiles(files, opts); err != nil {
+		t.Fatalf("RenameFiles() error = %v", err)
+	}
+
+	// scan1, Scan2, scan3, scan10, scan120
+	wantContent := map[string]byte{"001.png": 2, "002.png": 1, "003.png": 4, "004.png": 0, "005.png": 3}
+	for name, want := range wantContent {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if data[0] != want {
+			t.Errorf("%s holds file #%d, want #%d", name, data[0], want)
+		}
+	}
+}
+
+func TestParseSortKeys(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []SortKey
+		wantErr bool
+	}{
+		{input: "mtime", want: []SortKey{{Mode: SortByModificationTime}}},
+		{
+			input: "mtime,-size,name",
+			want:  []SortKey{{Mode: SortByModificationTime}, {Mode: SortBySize, Desc: true}, {Mode: SortByName}},
+		},
+		{input: "+ctime, -atime", want: []SortKey{{Mode: SortByCreationTime}, {Mode: SortByAccessTime, Desc: true}}},
+		{input: "mtime,color", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSortKeys(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSortKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseSortKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortFiles_MultiKey(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Second)
+	files := []FileInfo{
+		{Path: "/d/e.jpg", ModTime: t1, Size: 5},
+		{Path: "/d/c.jpg", ModTime: t0, Size: 5},
+		{Path: "/d/b.jpg", ModTime: t0, Size: 9},
+		{Path: "/d/d.jpg", ModTime: t0, Size: 5},
+		{Path: "/d/a.jpg", ModTime: t1, Size: 5},
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "ties broken by path",
+			opts: Options{FileMode: SortByModificationTime},
+			want: []string{"/d/b.jpg", "/d/c.jpg", "/d/d.jpg", "/d/a.jpg", "/d/e.jpg"},
+		},
+		{
+			name: "reverse inverts the whole order",
+			opts: Options{FileMode: SortByModificationTime, Reverse: true},
+			want: []string{"/d/e.jpg", "/d/a.jpg", "/d/d.jpg", "/d/c.jpg", "/d/b.jpg"},
+		},
+		{
+			name: "secondary descending key",
+			opts: Options{SortKeys: []SortKey{{Mode: SortByModificationTime}, {Mode: SortBySize, Desc: true}}},
+			want: []string{"/d/b.jpg", "/d/c.jpg", "/d/d.jpg", "/d/a.jpg", "/d/e.jpg"},
+		},
+		{
+			name: "size then descending mtime",
+			opts: Options{SortKeys: []SortKey{{Mode: SortBySize}, {Mode: SortByModificationTime, Desc: true}}},
+			want: []string{"/d/a.jpg", "/d/e.jpg", "/d/c.jpg", "/d/d.jpg", "/d/b.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The result must not depend on the input order
+			for _, perm := range [][]int{{0, 1, 2, 3, 4}, {4, 3, 2, 1, 0}, {2, 0, 4, 1, 3}} {
+				input := make([]FileInfo, len(files))
+				for i, p := range perm {
+					input[i] = files[p]
+				}
+				sortFiles(input, tt.opts)
+
+				got := make([]string, len(input))
+				for i, fi := range input {
+					got[i] = fi.Path
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("sortFiles(%v) = %v, want %v", perm, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFallbackWarnings(t *testing.T) {
+	files := []FileInfo{
+		{Path: "/d/a.txt", Genuine: CreateTimeField | ChangeTimeField | ModTimeField | AccessTimeField},
+		{Path: "/d/b.txt", Genuine: ChangeTimeField | ModTimeField | AccessTimeField},
+	}
+
+	if got := fallbackWarnings(files, Options{FileMode: SortByModificationTime}); len(got) != 0 {
+		t.Errorf("fallbackWarnings() = %v, want none for mtime", got)
+	}
+	got := fallbackWarnings(files, Options{SortKeys: []SortKey{{Mode: SortBySize}, {Mode: SortByCreationTime}}})
+	if len(got) != 1 || !strings.Contains(got[0], "/d/b.txt") {
+		t.Errorf("fallbackWarnings() = %v, want one warning naming /d/b.txt", got)
+	}
+}
+
+// jpegWithCaptureTime returns a minimal little-endian EXIF JPEG with DateTimeOriginal set to date
+func jpegWithCaptureTime(date string) []byte {
+	le := binary.LittleEndian
+	value := append([]byte(date), 0)
+	tiff := []byte("II*\x00")
+	tiff = le.AppendUint32(tiff, 8)
+	// IFD0: Exif IFD pointer -> 26
+	tiff = le.AppendUint16(tiff, 1)
+	tiff = le.AppendUint16(tiff, 0x8769)
+	tiff = le.AppendUint16(tiff, 4)
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint32(tiff, 26)
+	tiff = le.AppendUint32(tiff, 0)
+	// Exif IFD: DateTimeOriginal stored at 44
+	tiff = le.AppendUint16(tiff, 1)
+	tiff = le.AppendUint16(tiff, 0x9003)
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = le.AppendUint32(tiff, uint32(len(value)))
+	tiff = le.AppendUint32(tiff, 44)
+	tiff = le.AppendUint32(tiff, 0)
+	tiff = append(tiff, value...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	data = binary.BigEndian.AppendUint16(data, uint16(len(payload)+2))
+	data = append(data, payload...)
+	return append(data, 0xFF, 0xD9)
+}
+
+func TestRenameFiles_SortByCaptureTime(t *testing.T) {
+	dir := t.TempDir()
+	contents := map[string][]byte{
+		"a.jpg": jpegWithCaptureTime("2021:03:01 10:00:00"),
+		"b.jpg": jpegWithCaptureTime("2019:12:31 23:59:59"),
+		"c.jpg": []byte("no exif here"),
+	}
+	var files []string
+	for name, data := range contents {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	// The file without EXIF falls back to its modification time
+	future := time.Now().Add(24 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "c.jpg"), future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{Pattern: "0", FileMode: SortByCaptureTime, Init: 1}
+	if _, err := BuildPlan(files, opts); err == nil {
+		t.Fatal("BuildPlan() error = nil, want error for missing EXIF without fallback")
+	}
+
+	opts.CaptureTimeFallback = true
+	plan, err := BuildPlan(files, opts)
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+	if len(plan.Warnings) != 1 {
+		t.Errorf("plan warnings = %v, want one fallback warning", plan.Warnings)
+	}
+
+	var got []string
+	for _, e := range plan.Entries {
+		got = append(got, filepath.Base(e.Source))
+	}
+	if want := []string{"b.jpg", "a.jpg", "c.jpg"}; !slices.Equal(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
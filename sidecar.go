@@ -0,0 +1,82 @@
+package renby
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultPrimaryExts ranks the extensions chosen as the primary file of a
+// sidecar unit when Options.PrimaryExts is empty: raw formats first, then
+// rendered images. Unlisted extensions rank after the listed ones.
+var DefaultPrimaryExts = []string{
+	".cr2", ".cr3", ".nef", ".arw", ".dng", ".raf", ".orf", ".rw2", ".pef", ".srw",
+	".jpg", ".jpeg", ".heic", ".heif", ".tif", ".tiff", ".png",
+	".mov", ".mp4",
+}
+
+// primaryRank returns the priority of ext as primary file, lower is preferred
+func (o *Options) primaryRank(ext string) int {
+	exts := o.PrimaryExts
+	if len(exts) == 0 {
+		exts = DefaultPrimaryExts
+	}
+	ext = strings.ToLower(ext)
+	for i, e := range exts {
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if strings.ToLower(e) == ext {
+			return i
+		}
+	}
+	return len(exts)
+}
+
+// unitKey returns the directory and stem shared by the files of a unit
+func unitKey(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// splitSidecars returns the primary file of every unit in the order of the
+// sorted files, and the other members of each unit by primary path.
+// A unit is formed by the files sharing a directory and a stem.
+func splitSidecars(files []FileInfo, opts Options) ([]FileInfo, map[string][]FileInfo) {
+	units := make(map[string][]FileInfo)
+	for _, fi := range files {
+		key := unitKey(fi.Path)
+		units[key] = append(units[key], fi)
+	}
+
+	primaries := make(map[string]string, len(units))
+	sidecars := make(map[string][]FileInfo)
+	for key, members := range units {
+		sort.SliceStable(members, func(i, j int) bool {
+			ri, rj := opts.primaryRank(filepath.Ext(members[i].Path)), opts.primaryRank(filepath.Ext(members[j].Path))
+			if ri != rj {
+				return ri < rj
+			}
+			return members[i].Path < members[j].Path
+		})
+		primaries[key] = members[0].Path
+		if len(members) > 1 {
+			sidecars[members[0].Path] = members[1:]
+		}
+	}
+
+	var ordered []FileInfo
+	for _, fi := range files {
+		if primaries[unitKey(fi.Path)] == fi.Path {
+			ordered = append(ordered, fi)
+		}
+	}
+	return ordered, sidecars
+}
+
+// sidecarInfo returns the FileInfo naming sidecar like its primary:
+// placeholders use the values of the primary and the sidecar extension.
+func sidecarInfo(primary, sidecar FileInfo) FileInfo {
+	fi := primary
+	fi.Path = unitKey(primary.Path) + filepath.Ext(sidecar.Path)
+	return fi
+}
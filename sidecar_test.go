@@ -0,0 +1,115 @@
+package renby
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildPlan_Sidecars(t *testing.T) {
+	sizes := map[string]int{
+		"IMG_1234.CR2": 30,
+		"IMG_1234.jpg": 20,
+		"IMG_1234.xmp": 100,
+		"IMG_0001.jpg": 40,
+		"IMG_0001.xmp": 1,
+		"notes.txt":    35,
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want map[string]string
+	}{
+		{
+			name: "raw is primary",
+			opts: Options{Pattern: "0", FileMode: SortBySize, Init: 1, Sidecars: true},
+			want: map[string]string{
+				"IMG_1234.CR2": "1.CR2", "IMG_1234.jpg": "1.jpg", "IMG_1234.xmp": "1.xmp",
+				"notes.txt":    "2.txt",
+				"IMG_0001.jpg": "3.jpg", "IMG_0001.xmp": "3.xmp",
+			},
+		},
+		{
+			name: "custom primary extensions",
+			opts: Options{Pattern: "0", FileMode: SortBySize, Init: 1, Sidecars: true, PrimaryExts: []string{"xmp"}},
+			want: map[string]string{
+				"IMG_0001.jpg": "1.jpg", "IMG_0001.xmp": "1.xmp",
+				"notes.txt":    "2.txt",
+				"IMG_1234.CR2": "3.CR2", "IMG_1234.jpg": "3.jpg", "IMG_1234.xmp": "3.xmp",
+			},
+		},
+		{
+			name: "placeholders use the primary",
+			opts: Options{Template: "{n}_{size}{ext}", FileMode: SortBySize, Init: 1, Sidecars: true},
+			want: map[string]string{
+				"IMG_1234.CR2": "1_30.CR2", "IMG_1234.jpg": "1_30.jpg", "IMG_1234.xmp": "1_30.xmp",
+				"notes.txt":    "2_35.txt",
+				"IMG_0001.jpg": "3_40.jpg", "IMG_0001.xmp": "3_40.xmp",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := writeSizedFiles(t, dir, sizes)
+
+			plan, err := BuildPlan(files, tt.opts)
+			if err != nil {
+				t.Fatalf("BuildPlan() error = %v", err)
+			}
+			if plan.HasConflicts() {
+				t.Fatalf("unexpected conflicts: %v", plan.Conflicts)
+			}
+			if len(plan.Entries) != len(sizes) {
+				t.Fatalf("got %d entries, want %d", len(plan.Entries), len(sizes))
+			}
+			for _, e := range plan.Entries {
+				src := filepath.Base(e.Source)
+				if got := filepath.Base(e.Destination); got != tt.want[src] {
+					t.Errorf("%s -> %s, want %s", src, got, tt.want[src])
+				}
+			}
+		})
+	}
+}
+
+func TestBuildPlan_SidecarConflicts(t *testing.T) {
+	dir := t.TempDir()
+	files := writeSizedFiles(t, dir, map[string]int{"a.jpg": 1, "a.xmp": 2})
+
+	// without {ext}, both members map to the same name
+	plan, err := BuildPlan(files, Options{Template: "photo_{n}", FileMode: SortBySize, Init: 1, Sidecars: true})
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+	if len(plan.Conflicts) != 1 || plan.Conflicts[0].Kind != ConflictDuplicateDestination {
+		t.Errorf("Conflicts = %v, want one duplicate destination", plan.Conflicts)
+	}
+	for _, e := range plan.Entries {
+		if filepath.Base(e.Source) == "a.xmp" && e.Primary != filepath.Join(dir, "a.jpg") {
+			t.Errorf("sidecar Primary = %q, want a.jpg", e.Primary)
+		}
+	}
+}
+
+func TestBuildPlan_SidecarsCloseGaps(t *testing.T) {
+	dir := t.TempDir()
+	files := writeSizedFiles(t, dir, map[string]int{"000001.cr2": 20, "000001.xmp": 1, "000003.cr2": 10, "000003.xmp": 2})
+
+	// the conforming names of sidecars belong to the batch and are not reserved
+	plan, err := BuildPlan(files, Options{Pattern: "000000", FileMode: SortBySize, Init: 1, Sidecars: true, CloseGaps: true})
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+	if plan.HasConflicts() {
+		t.Fatalf("unexpected conflicts: %v", plan.Conflicts)
+	}
+	want := map[string]string{"000001.cr2": "000001.cr2", "000001.xmp": "000001.xmp", "000003.cr2": "000002.cr2", "000003.xmp": "000002.xmp"}
+	for _, e := range plan.Entries {
+		src := filepath.Base(e.Source)
+		if got := filepath.Base(e.Destination); got != want[src] {
+			t.Errorf("%s -> %s, want %s", src, got, want[src])
+		}
+	}
+}
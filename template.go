@@ -0,0 +1,258 @@
+package renby
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTimeLayout = "20060102"
+
+// sortTimeMode marks the {time} placeholder until bindSortTime resolves it
+const sortTimeMode SortMode = -1
+
+// segmentKind represents the kind of a template segment
+type segmentKind int
+
+const (
+	segLiteral segmentKind = iota
+	segCounter
+	segName
+	segExt
+	segDir
+	segSize
+	segTime
+)
+
+// segment is a literal text or a placeholder of a template
+type segment struct {
+	kind   segmentKind
+	text   string       // segLiteral: text
+	width  int          // segCounter: zero-padded width
+	style  CounterStyle // segCounter: counter style
+	mode   SortMode     // segTime: timestamp
+	layout string       // segTime: time layout
+}
+
+// template is a parsed naming template such as "{n:04}_{name}{ext}"
+type template struct {
+	segments []segment
+}
+
+// timePlaceholders maps time placeholders to the timestamp they format
+var timePlaceholders = map[string]SortMode{
+	"ctime":  SortByCreationTime,
+	"chtime": SortByChangeTime,
+	"mtime":  SortByModificationTime,
+	"atime":  SortByAccessTime,
+	"exif":   SortByCaptureTime,
+	"time":   sortTimeMode,
+}
+
+// parseTemplate parses a naming template.
+//
+//	{n}, {n:04}, {n:4X}  counter, optionally zero-padded, with a style
+//	                     character as in patterns (x X a A z Z i I)
+//	{name}               original file name without extension
+//	{ext}                original extension including the dot
+//	{dir}                name of the parent directory
+//	{size}               file size in bytes
+//	{mtime:LAYOUT}       timestamp in Go time layout (also ctime, chtime, atime, exif)
+//	{time:LAYOUT}        timestamp the files are sorted by
+//	{{ and }}            literal braces
+func parseTemplate(s string) (*template, error) {
+	t := &template{}
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			t.segments = append(t.segments, segment{kind: segLiteral, text: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '{' && strings.HasPrefix(s[i:], "{{"):
+			literal.WriteByte('{')
+			i++
+		case c == '}' && strings.HasPrefix(s[i:], "}}"):
+			literal.WriteByte('}')
+			i++
+		case c == '}':
+			return nil, fmt.Errorf("unexpected '}' at position %d in template", i)
+		case c == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed '{' at position %d in template", i)
+			}
+			seg, err := parsePlaceholder(s[i+1 : i+end])
+			if err != nil {
+				return nil, err
+			}
+			flush()
+			t.segments = append(t.segments, seg)
+			i += end
+		case c == '/' || c == filepath.Separator:
+			return nil, fmt.Errorf("template must not contain path separators")
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	flush()
+
+	if len(t.segments) == 0 {
+		return nil, fmt.Errorf("template cannot be empty")
+	}
+	return t, nil
+}
+
+// parsePlaceholder parses the inside of a {...} placeholder
+func parsePlaceholder(p string) (segment, error) {
+	name, spec, hasSpec := strings.Cut(p, ":")
+	switch name {
+	case "n":
+		seg := segment{kind: segCounter}
+		if hasSpec {
+			if last := len(spec) - 1; last >= 0 && !isDigit(spec[last]) {
+				style, ok := counterStyleOf(spec[last])
+				if !ok {
+					return segment{}, fmt.Errorf("invalid counter format %q in template", p)
+				}
+				seg.style = style
+				spec = spec[:last]
+			}
+			if spec != "" {
+				width, err := strconv.Atoi(spec)
+				if err != nil || width < 0 {
+					return segment{}, fmt.Errorf("invalid counter format %q in template", p)
+				}
+				seg.width = width
+			}
+		}
+		return seg, nil
+	case "name", "ext", "dir", "size":
+		if hasSpec {
+			return segment{}, fmt.Errorf("placeholder {%s} takes no format", name)
+		}
+		kinds := map[string]segmentKind{"name": segName, "ext": segExt, "dir": segDir, "size": segSize}
+		return segment{kind: kinds[name]}, nil
+	}
+
+	mode, ok := timePlaceholders[name]
+	if !ok {
+		return segment{}, fmt.Errorf("unknown placeholder {%s} in template", name)
+	}
+	layout := defaultTimeLayout
+	if hasSpec {
+		if spec == "" {
+			return segment{}, fmt.Errorf("empty time layout in {%s}", p)
+		}
+		if strings.ContainsAny(spec, "/"+string(filepath.Separator)) {
+			return segment{}, fmt.Errorf("time layout in {%s} must not contain path separators", p)
+		}
+		layout = spec
+	}
+	return segment{kind: segTime, mode: mode, layout: layout}, nil
+}
+
+// legacyTemplate builds the template equivalent to Pre, Pattern and Post:
+// the pattern length sets the pad width and its characters the counter style.
+func legacyTemplate(pre, pattern, post string) *template {
+	t := &template{}
+	if pre != "" {
+		t.segments = append(t.segments, segment{kind: segLiteral, text: pre})
+	}
+	t.segments = append(t.segments, segment{kind: segCounter, width: len(pattern), style: patternStyle(pattern)})
+	if post != "" {
+		t.segments = append(t.segments, segment{kind: segLiteral, text: post})
+	}
+	t.segments = append(t.segments, segment{kind: segExt})
+	return t
+}
+
+// bindSortTime resolves the {time} placeholders to mode
+func (t *template) bindSortTime(mode SortMode) {
+	for i, seg := range t.segments {
+		if seg.kind == segTime && seg.mode == sortTimeMode {
+			t.segments[i].mode = mode
+		}
+	}
+}
+
+// uses reports whether the template formats the given timestamp
+func (t *template) uses(mode SortMode) bool {
+	for _, seg := range t.segments {
+		if seg.kind == segTime && seg.mode == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// counterFormat overrides how execute formats counters
+type counterFormat struct {
+	formatter CounterFormatter // replaces the counter styles of the template when set
+	autoWidth bool             // pad to the width of largest instead of the template width
+	largest   int
+}
+
+// execute renders the file name for fi numbered with counter
+func (t *template) execute(fi FileInfo, counter int, cf counterFormat) (string, error) {
+	base := filepath.Base(fi.Path)
+	ext := filepath.Ext(base)
+
+	var b strings.Builder
+	for _, seg := range t.segments {
+		switch seg.kind {
+		case segLiteral:
+			b.WriteString(seg.text)
+		case segCounter:
+			f := cf.formatter
+			if f == nil {
+				f = seg.style
+			}
+			width := seg.width
+			if cf.autoWidth {
+				largest, err := f.FormatCounter(cf.largest, 0)
+				if err != nil {
+					return "", err
+				}
+				width = len(largest)
+			}
+			c, err := f.FormatCounter(counter, width)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(c)
+		case segName:
+			b.WriteString(strings.TrimSuffix(base, ext))
+		case segExt:
+			b.WriteString(ext)
+		case segDir:
+			b.WriteString(filepath.Base(filepath.Dir(fi.Path)))
+		case segSize:
+			b.WriteString(strconv.FormatInt(fi.Size, 10))
+		case segTime:
+			b.WriteString(fileTime(fi, seg.mode).Format(seg.layout))
+		}
+	}
+	return b.String(), nil
+}
+
+// fileTime returns the timestamp of fi selected by mode
+func fileTime(fi FileInfo, mode SortMode) time.Time {
+	switch mode {
+	case SortByCreationTime:
+		return fi.CreateTime
+	case SortByChangeTime:
+		return fi.ChangeTime
+	case SortByAccessTime:
+		return fi.AccessTime
+	case SortByCaptureTime:
+		return fi.CaptureTime
+	default:
+		return fi.ModTime
+	}
+}
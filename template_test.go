@@ -0,0 +1,87 @@
+package renby
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTemplate(t *testing.T) {
+	mtime := time.Date(2024, 2, 29, 13, 45, 0, 0, time.Local)
+	fi := FileInfo{Path: "/photos/trip/IMG_0042.jpg", Size: 2048, ModTime: mtime}
+
+	tests := []struct {
+		name    string
+		tmpl    string
+		counter int
+		want    string
+	}{
+		{name: "counter with width", tmpl: "{n:04}{ext}", counter: 7, want: "0007.jpg"},
+		{name: "counter without width", tmpl: "{n}{ext}", counter: 123, want: "123.jpg"},
+		{name: "hex counter", tmpl: "{n:3x}{ext}", counter: 255, want: "0ff.jpg"},
+		{name: "upper hex counter", tmpl: "{n:3X}{ext}", counter: 255, want: "0FF.jpg"},
+		{name: "roman counter", tmpl: "ch{n:I}{ext}", counter: 14, want: "chXIV.jpg"},
+		{name: "name and date", tmpl: "{n:04}_{name}_{mtime:2006-01-02}{ext}", counter: 1, want: "0001_IMG_0042_2024-02-29.jpg"},
+		{name: "default time layout", tmpl: "{mtime}-{n}", counter: 5, want: "20240229-5"},
+		{name: "dir and size", tmpl: "{dir}_{size}{ext}", counter: 1, want: "trip_2048.jpg"},
+		{name: "escaped braces", tmpl: "{{{n}}}{ext}", counter: 2, want: "{2}.jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseTemplate(tt.tmpl)
+			if err != nil {
+				t.Fatalf("parseTemplate() error = %v", err)
+			}
+			got, err := tmpl.execute(fi, tt.counter, counterFormat{})
+			if err != nil {
+				t.Fatalf("execute() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("execute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTemplate_Invalid(t *testing.T) {
+	tests := []struct {
+		tmpl    string
+		wantErr string
+	}{
+		{tmpl: "", wantErr: "cannot be empty"},
+		{tmpl: "{n", wantErr: "unclosed"},
+		{tmpl: "n}", wantErr: "unexpected '}'"},
+		{tmpl: "{count}", wantErr: "unknown placeholder"},
+		{tmpl: "{n:4q}", wantErr: "invalid counter format"},
+		{tmpl: "{n:x4}", wantErr: "invalid counter format"},
+		{tmpl: "{name:x}", wantErr: "takes no format"},
+		{tmpl: "{mtime:}", wantErr: "empty time layout"},
+		{tmpl: "{mtime:2006/01}", wantErr: "path separators"},
+		{tmpl: "sub/{n}", wantErr: "path separators"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tmpl, func(t *testing.T) {
+			_, err := parseTemplate(tt.tmpl)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseTemplate(%q) error = %v, want error containing %q", tt.tmpl, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOptionsValidate_Template(t *testing.T) {
+	opts := Options{Template: "{n:02}{ext}", Pre: "img"}
+	if err := opts.Validate(); err == nil {
+		t.Error("Validate() error = nil, want error when combining template and prefix")
+	}
+
+	opts = Options{Template: "{n:02}{ext}"}
+	if err := opts.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if got, err := generateNewName(FileInfo{Path: "/d/a.txt"}, 2, opts.counterFormat(2), opts); err != nil || got != "/d/02.txt" {
+		t.Errorf("generateNewName() = %q, %v, want %q", got, err, "/d/02.txt")
+	}
+}
@@ -0,0 +1,140 @@
+package renby
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/hidez8891/go-renby/internal/ostime"
+)
+
+// Mode represents how a source is brought to its destination
+type Mode int
+
+const (
+	// ModeMove renames the source, the default
+	ModeMove Mode = iota
+	// ModeCopy copies the content, permissions and timestamps of the source
+	ModeCopy
+	// ModeHardlink links the destination to the source
+	ModeHardlink
+	// ModeSymlink creates a symbolic link to the absolute source path
+	ModeSymlink
+)
+
+// modeNames are the names of the modes used on the command line and in journals
+var modeNames = []string{"move", "copy", "hardlink", "symlink"}
+
+// ParseMode returns the mode for a name such as "copy"
+func ParseMode(name string) (Mode, error) {
+	for i, n := range modeNames {
+		if n == name {
+			return Mode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown mode '%s'", name)
+}
+
+// String returns the name of the mode
+func (m Mode) String() string {
+	if m < 0 || int(m) >= len(modeNames) {
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+	return modeNames[m]
+}
+
+// valid reports whether m is one of the defined modes
+func (m Mode) valid() bool {
+	return m >= 0 && int(m) < len(modeNames)
+}
+
+// sameFilesystem reports whether a file and a directory are on the same
+// filesystem, replaced in tests to simulate other filesystems
+var sameFilesystem = sameDevice
+
+// checkLinkable fails before any file is touched when a hard link of the
+// plan would cross filesystems, which only moves and copies can
+func (p *Plan) checkLinkable() error {
+	for _, e := range p.Entries {
+		if e.Unchanged() {
+			continue
+		}
+		dir := filepath.Dir(e.Destination)
+		same, err := sameFilesystem(e.Source, dir)
+		if os.IsNotExist(err) {
+			continue // reported when the link is created
+		}
+		if err != nil {
+			return err
+		}
+		if !same {
+			return fmt.Errorf("cannot hardlink %q into %q: hard links cannot cross filesystems", e.Source, dir)
+		}
+	}
+	return nil
+}
+
+// createFrom creates to from the source from according to mode,
+// leaving from untouched. to must not exist.
+func createFrom(mode Mode, from, to string) error {
+	switch mode {
+	case ModeCopy:
+		return copyFile(from, to)
+	case ModeHardlink:
+		return os.Link(from, to)
+	case ModeSymlink:
+		target, err := filepath.Abs(from)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, to)
+	default:
+		return fmt.Errorf("mode %v does not create files", mode)
+	}
+}
+
+// copyFile copies the content of from to the new file to, syncs it and
+// preserves the permissions and the access and modification times
+func copyFile(from, to string) (err error) {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(to)
+		}
+	}()
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+
+	// the umask may have narrowed the permissions of the new file
+	if err = os.Chmod(to, info.Mode().Perm()); err != nil {
+		return err
+	}
+	times, err := ostime.GetOsTime(from, info)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(to, times.AccessTime, times.ModificationTime)
+}
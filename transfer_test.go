@@ -0,0 +1,250 @@
+package renby
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseMode(t *testing.T) {
+	for i, name := range []string{"move", "copy", "hardlink", "symlink"} {
+		mode, err := ParseMode(name)
+		if err != nil || mode != Mode(i) {
+			t.Errorf("ParseMode(%q) = %v, %v, want %v", name, mode, err, Mode(i))
+		}
+		if got := mode.String(); got != name {
+			t.Errorf("Mode(%d).String() = %q, want %q", i, got, name)
+		}
+	}
+	if _, err := ParseMode("link"); err == nil {
+		t.Error("ParseMode(\"link\") error = nil, want error")
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.txt"), filepath.Join(dir, "dst.txt")
+	if err := os.WriteFile(src, []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(src, 0640); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		t.Fatalf("copyFile() error = %v", err)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil || string(data) != "content" {
+		t.Fatalf("copied content = %q, %v", data, err)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("copied permissions = %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("copied mtime = %v, want %v", info.ModTime(), mtime)
+	}
+
+	if err := copyFile(src, dst); err == nil {
+		t.Error("copyFile() onto an existing file: error = nil, want error")
+	}
+}
+
+func TestApply_Modes(t *testing.T) {
+	for _, mode := range []Mode{ModeMove, ModeCopy, ModeHardlink, ModeSymlink} {
+		for _, force := range []bool{false, true} {
+			name := mode.String()
+			if force {
+				name += " two-phase"
+			}
+			t.Run(name, func(t *testing.T) {
+				dir := t.TempDir()
+				outDir := filepath.Join(t.TempDir(), "out", "numbered")
+				files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20})
+
+				opts := Options{Pattern: "0", FileMode: SortBySize, Init: 1, OutDir: outDir, Mode: mode, ForceOverwrite: force}
+				if err := RenameFiles(files, opts); err != nil {
+					t.Fatalf("RenameFiles() error = %v", err)
+				}
+
+				if got, want := listNames(t, outDir), []string{"1.txt", "2.txt"}; !slices.Equal(got, want) {
+					t.Fatalf("names in output directory = %v, want %v", got, want)
+				}
+				wantSources := []string{"a.txt", "b.txt"}
+				if mode == ModeMove {
+					wantSources = []string{}
+				}
+				if got := listNames(t, dir); !slices.Equal(got, wantSources) {
+					t.Errorf("names in source directory = %v, want %v", got, wantSources)
+				}
+
+				dst := filepath.Join(outDir, "1.txt")
+				if info, err := os.Stat(dst); err != nil || info.Size() != 10 {
+					t.Fatalf("stat %s = %v, %v, want 10 bytes", dst, info, err)
+				}
+				switch mode {
+				case ModeHardlink:
+					src, _ := os.Stat(filepath.Join(dir, "a.txt"))
+					linked, _ := os.Stat(dst)
+					if !os.SameFile(src, linked) {
+						t.Error("hardlink does not share the source file")
+					}
+				case ModeSymlink:
+					target, err := os.Readlink(dst)
+					if err != nil || target != filepath.Join(dir, "a.txt") {
+						t.Errorf("symlink target = %q, %v, want %q", target, err, filepath.Join(dir, "a.txt"))
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestBuildPlan_CopyOntoSource(t *testing.T) {
+	dir := t.TempDir()
+	files := writeSizedFiles(t, dir, map[string]int{"1.txt": 10, "b.txt": 20})
+
+	// moving 1.txt away first frees its name, copying does not
+	opts := Options{Pattern: "0", FileMode: SortBySize, Init: 0}
+	for _, tt := range []struct {
+		mode Mode
+		want []ConflictKind
+	}{
+		{ModeMove, nil},
+		{ModeCopy, []ConflictKind{ConflictDestinationExists}},
+	} {
+		opts.Mode = tt.mode
+		plan, err := BuildPlan(files, opts)
+		if err != nil {
+			t.Fatalf("BuildPlan() error = %v", err)
+		}
+		var got []ConflictKind
+		for _, c := range plan.Conflicts {
+			got = append(got, c.Kind)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%v: conflicts = %v, want %v", tt.mode, plan.Conflicts, tt.want)
+		}
+	}
+}
+
+func TestUndo_Copy(t *testing.T) {
+	dir := t.TempDir()
+	journalDir := t.TempDir()
+	files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20})
+
+	opts := Options{Pattern: "0", FileMode: SortBySize, Init: 1, Mode: ModeCopy, ForceOverwrite: true, JournalDir: journalDir}
+	if err := RenameFiles(files, opts); err != nil {
+		t.Fatalf("RenameFiles() error = %v", err)
+	}
+	if got, want := listNames(t, dir), []string{"1.txt", "2.txt", "a.txt", "b.txt"}; !slices.Equal(got, want) {
+		t.Fatalf("names after copy = %v, want %v", got, want)
+	}
+
+	path, err := LatestJournal(journalDir)
+	if err != nil {
+		t.Fatalf("LatestJournal() error = %v", err)
+	}
+	if err := Undo(path); err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	if got, want := listNames(t, dir), []string{"a.txt", "b.txt"}; !slices.Equal(got, want) {
+		t.Errorf("names after undo = %v, want %v", got, want)
+	}
+}
+
+func TestApply_CopyRollback(t *testing.T) {
+	dir := t.TempDir()
+	journalDir := t.TempDir()
+	files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20, "c.txt": 30})
+
+	opts := Options{Pattern: "0", FileMode: SortBySize, Init: 1, Mode: ModeCopy, ForceOverwrite: true, JournalDir: journalDir}
+	plan, err := BuildPlan(files, opts)
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	before := listNames(t, dir)
+
+	err = plan.Apply(context.Background())
+	var rbErr *RollbackError
+	if !errors.As(err, &rbErr) || len(rbErr.Rollback) != 0 {
+		t.Fatalf("Apply() error = %v, want a complete rollback", err)
+	}
+	if got := listNames(t, dir); !slices.Equal(got, before) {
+		t.Errorf("names after rollback = %v, want %v", got, before)
+	}
+	if _, err := LatestJournal(journalDir); !errors.Is(err, ErrNoJournal) {
+		t.Errorf("journal of a rolled back batch should be discarded, got %v", err)
+	}
+}
+
+func TestRecover_Copy(t *testing.T) {
+	for _, mode := range []RecoverMode{RecoverComplete, RecoverRevert} {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "a.txt")
+		if err := os.WriteFile(src, []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// phase one was interrupted while copying a.txt
+		pid, counter := 99999, 0
+		dst := filepath.Join(dir, "1.txt")
+		e := intentEntry{Op: "copy", Source: src, Temp: tempName(dst, pid, &counter), Backup: tempName(dst, pid, &counter), Destination: dst}
+		intent := newIntentLog(pid)
+		intent.add(e)
+		if err := intent.write(intentPhase1); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(e.Temp, []byte("cont"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Recover(dir, mode); err != nil {
+			t.Fatalf("Recover() error = %v", err)
+		}
+		want := []string{"a.txt"}
+		if mode == RecoverComplete {
+			want = []string{"1.txt", "a.txt"}
+			if data, err := os.ReadFile(dst); err != nil || string(data) != "content" {
+				t.Errorf("completed copy = %q, %v, want %q", data, err, "content")
+			}
+		}
+		if got := listNames(t, dir); !slices.Equal(got, want) {
+			t.Errorf("names after recovery = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestApply_HardlinkAcrossDevices(t *testing.T) {
+	simulateDevices(t)
+	dir := t.TempDir()
+	outDir := filepath.Join(t.TempDir(), "usb")
+	files := writeSizedFiles(t, dir, map[string]int{"a.txt": 10, "b.txt": 20})
+
+	for _, force := range []bool{false, true} {
+		opts := Options{Pattern: "0", FileMode: SortBySize, Init: 1, OutDir: outDir, Mode: ModeHardlink, ForceOverwrite: force}
+		err := RenameFiles(files, opts)
+		var rbErr *RollbackError
+		if err == nil || errors.As(err, &rbErr) {
+			t.Fatalf("force=%v: RenameFiles() error = %v, want an error before any link", force, err)
+		}
+		if got := listNames(t, outDir); len(got) != 0 {
+			t.Errorf("force=%v: names in output directory = %v, want none", force, got)
+		}
+	}
+}
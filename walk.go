@@ -0,0 +1,157 @@
+package renby
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WalkOptions controls which files Walk collects under a directory
+type WalkOptions struct {
+	// Include keeps only files matching one of the globs when set.
+	// A glob without '/' matches the base name, otherwise the slash separated
+	// path relative to the root, where "**" matches any number of directories.
+	Include []string
+	// Exclude drops files and prunes directories matching one of the globs
+	Exclude        []string
+	MaxDepth       int  // levels below the root to descend into, 0: unlimited
+	FollowSymlinks bool // descend into linked directories and collect linked files
+	Hidden         bool // collect hidden files and descend into hidden directories
+}
+
+// Validate checks the include and exclude globs
+func (o *WalkOptions) Validate() error {
+	if o.MaxDepth < 0 {
+		return fmt.Errorf("max depth must be non-negative")
+	}
+	for _, globs := range [][]string{o.Include, o.Exclude} {
+		for _, glob := range globs {
+			if _, err := path.Match(glob, ""); err != nil || glob == "" {
+				return fmt.Errorf("invalid glob '%s'", glob)
+			}
+		}
+	}
+	return nil
+}
+
+// Walk returns the files under root accepted by the options in lexical order.
+// Symbolic links are skipped unless FollowSymlinks is set, in which case
+// directory cycles are visited once.
+func Walk(root string, opts WalkOptions) ([]string, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid walk options: %w", err)
+	}
+
+	w := &walker{opts: opts, root: root, visited: make(map[string]struct{})}
+	if err := w.walk(root, 1); err != nil {
+		return nil, err
+	}
+	return w.files, nil
+}
+
+// walker holds the state of a single Walk
+type walker struct {
+	opts    WalkOptions
+	root    string
+	visited map[string]struct{} // resolved directories, guards against link cycles
+	files   []string
+}
+
+func (w *walker) walk(dir string, depth int) error {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve directory: %w", err)
+	}
+	if _, ok := w.visited[resolved]; ok {
+		return nil
+	}
+	w.visited[resolved] = struct{}{}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !w.opts.Hidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		p := filepath.Join(dir, name)
+		rel, err := filepath.Rel(w.root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if matchAny(w.opts.Exclude, rel) {
+			continue
+		}
+
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			if !w.opts.FollowSymlinks {
+				continue
+			}
+			info, err := os.Stat(p)
+			if err != nil {
+				continue // dangling link
+			}
+			isDir = info.IsDir()
+		}
+
+		switch {
+		case isDir:
+			if w.opts.MaxDepth == 0 || depth < w.opts.MaxDepth {
+				if err := w.walk(p, depth+1); err != nil {
+					return err
+				}
+			}
+		case len(w.opts.Include) == 0 || matchAny(w.opts.Include, rel):
+			w.files = append(w.files, p)
+		}
+	}
+	return nil
+}
+
+// matchAny reports whether the slash separated relative path matches any glob
+func matchAny(globs []string, rel string) bool {
+	for _, glob := range globs {
+		if matchGlob(glob, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a glob against a slash separated relative path.
+// A glob without '/' matches the base name; "**" matches zero or more
+// path segments.
+func matchGlob(glob, rel string) bool {
+	if !strings.Contains(glob, "/") {
+		ok, _ := path.Match(glob, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(glob, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(globs, segs []string) bool {
+	for len(globs) > 0 {
+		if globs[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(globs[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(globs[0], segs[0]); !ok {
+			return false
+		}
+		globs, segs = globs[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
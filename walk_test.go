@@ -0,0 +1,128 @@
+package renby
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// makeTree creates empty files (and their directories) under root
+func makeTree(t *testing.T, root string, files ...string) {
+	t.Helper()
+	for _, f := range files {
+		path := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+	makeTree(t, root,
+		"a.jpg", "b.txt", ".hidden.jpg",
+		"shoot/c.jpg", "shoot/raw/d.cr2", "shoot/raw/e.jpg",
+		".git/config", "build/out.jpg",
+	)
+
+	tests := []struct {
+		name string
+		opts WalkOptions
+		want []string
+	}{
+		{
+			name: "all visible files",
+			want: []string{"a.jpg", "b.txt", "build/out.jpg", "shoot/c.jpg", "shoot/raw/d.cr2", "shoot/raw/e.jpg"},
+		},
+		{
+			name: "hidden",
+			opts: WalkOptions{Hidden: true, Include: []string{"*.jpg", ".git/**"}},
+			want: []string{".git/config", ".hidden.jpg", "a.jpg", "build/out.jpg", "shoot/c.jpg", "shoot/raw/e.jpg"},
+		},
+		{
+			name: "include base name",
+			opts: WalkOptions{Include: []string{"*.jpg"}},
+			want: []string{"a.jpg", "build/out.jpg", "shoot/c.jpg", "shoot/raw/e.jpg"},
+		},
+		{
+			name: "include double star",
+			opts: WalkOptions{Include: []string{"shoot/**/*.jpg"}},
+			want: []string{"shoot/c.jpg", "shoot/raw/e.jpg"},
+		},
+		{
+			name: "exclude prunes directories",
+			opts: WalkOptions{Exclude: []string{"build", "raw/**", "*.txt"}},
+			want: []string{"a.jpg", "shoot/c.jpg", "shoot/raw/d.cr2", "shoot/raw/e.jpg"},
+		},
+		{
+			name: "exclude path",
+			opts: WalkOptions{Exclude: []string{"shoot/raw/**"}},
+			want: []string{"a.jpg", "b.txt", "build/out.jpg", "shoot/c.jpg"},
+		},
+		{
+			name: "max depth",
+			opts: WalkOptions{MaxDepth: 2},
+			want: []string{"a.jpg", "b.txt", "build/out.jpg", "shoot/c.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := Walk(root, tt.opts)
+			if err != nil {
+				t.Fatalf("Walk() error = %v", err)
+			}
+			got := make([]string, len(files))
+			for i, f := range files {
+				rel, _ := filepath.Rel(root, f)
+				got[i] = filepath.ToSlash(rel)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Walk() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalk_Symlinks(t *testing.T) {
+	root := t.TempDir()
+	other := t.TempDir()
+	makeTree(t, root, "a.jpg")
+	makeTree(t, other, "b.jpg")
+	if err := os.Symlink(other, filepath.Join(root, "linked")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "a.jpg"), filepath.Join(root, "link.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(other, "cycle")); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := Walk(root, WalkOptions{})
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	if want := []string{filepath.Join(root, "a.jpg")}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Walk() = %v, want %v", files, want)
+	}
+
+	files, err = Walk(root, WalkOptions{FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	want := []string{filepath.Join(root, "a.jpg"), filepath.Join(root, "link.jpg"), filepath.Join(root, "linked", "b.jpg")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Walk() = %v, want %v", files, want)
+	}
+}
+
+func TestWalk_InvalidGlob(t *testing.T) {
+	if _, err := Walk(t.TempDir(), WalkOptions{Include: []string{"["}}); err == nil {
+		t.Error("Walk() error = nil, want error for invalid glob")
+	}
+}
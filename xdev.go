@@ -0,0 +1,39 @@
+//go:build !windows
+
+package renby
+
+import (
+	"os"
+	"syscall"
+)
+
+// errCrossDevice is returned by a rename between different filesystems
+var errCrossDevice error = syscall.EXDEV
+
+// syncDir flushes the entries of dir, e.g. a file renamed into it, to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// sameDevice reports whether the file a and the directory b are on the same filesystem
+func sameDevice(a, b string) (bool, error) {
+	ia, err := os.Lstat(a)
+	if err != nil {
+		return false, err
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	sa, okA := ia.Sys().(*syscall.Stat_t)
+	sb, okB := ib.Sys().(*syscall.Stat_t)
+	if !okA || !okB {
+		return true, nil // let the link itself fail
+	}
+	return sa.Dev == sb.Dev, nil
+}
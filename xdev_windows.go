@@ -0,0 +1,37 @@
+//go:build windows
+
+package renby
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// errCrossDevice is ERROR_NOT_SAME_DEVICE, returned by a rename between different volumes
+var errCrossDevice error = syscall.Errno(17)
+
+// syncDir does nothing: Windows cannot open a directory to sync it
+func syncDir(dir string) error {
+	return nil
+}
+
+// sameDevice reports whether the file a and the directory b are on the same volume
+func sameDevice(a, b string) (bool, error) {
+	if _, err := os.Lstat(a); err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(b); err != nil {
+		return false, err
+	}
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(filepath.VolumeName(absA), filepath.VolumeName(absB)), nil
+}